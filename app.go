@@ -5,13 +5,24 @@ import (
 	"contentive/internal/config"
 	"contentive/internal/database"
 	llm "contentive/internal/llm"
+	"contentive/internal/llm/cache"
+	"contentive/internal/llm/doubao"
+	"contentive/internal/llm/hashing"
+	"contentive/internal/llm/ollama"
 	"contentive/internal/llm/openai"
+	"contentive/internal/llm/qwen"
+	"contentive/internal/llm/router"
+	"contentive/internal/logger"
+	"contentive/internal/rag"
 	adminroutes "contentive/internal/routes/admin"
 	apiroutes "contentive/internal/routes/api"
+	"contentive/internal/scheduler"
 	"contentive/internal/storage"
 	"contentive/internal/storage/aliyun"
 	"contentive/internal/storage/local"
+	"context"
 	"log"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -26,9 +37,21 @@ func main() {
 	// init LLM	Provider
 	initLLMProvider()
 
+	// init embedding provider
+	initEmbeddingProvider()
+
 	// init storage
 	initStorageProvider()
 
+	// keep the knowledge index in sync with published content
+	rag.StartWorker(context.Background())
+	if err := rag.EnqueueStale(); err != nil {
+		logger.Error("Failed to queue stale content for indexing: %v", err)
+	}
+
+	// publish and unpublish scheduled content
+	scheduler.Start(context.Background(), time.Duration(config.AppConfig.SCHEDULER_INTERVAL)*time.Second)
+
 	app := fiber.New()
 
 	app.Use(cors.New(cors.Config{
@@ -42,6 +65,7 @@ func main() {
 	adminroutes.RegisterAdminSchemaRoutes(app)
 	adminroutes.RegisterAdminContentRoutes(app)
 	adminroutes.RegisterAdminMediaRoutes(app)
+	adminroutes.RegisterAdminLLMRoutes(app)
 
 	apiroutes.RegisterAPIContentRoutes(app)
 	apiroutes.RegisterAPIMediaRoutes(app)
@@ -77,25 +101,120 @@ func initStorageProvider() {
 	}
 }
 
-// initLLMProvider initializes the appropriate LLM provider based on configuration
+// initLLMProvider initializes the LLM provider based on configuration. The
+// configured provider and its fallbacks are wrapped in a router, which retries
+// failed requests and fails over to the next provider.
 func initLLMProvider() {
-	switch config.AppConfig.LLM_PROVIDER {
-	case "openai":
-		llm.SetProvider(openai.NewOpenAIProvider(
+	backends := []router.Backend{{
+		Name: config.AppConfig.LLM_PROVIDER,
+		Provider: newLLMProvider(
+			config.AppConfig.LLM_PROVIDER,
 			config.AppConfig.LLM_API_KEY,
 			config.AppConfig.LLM_BASE_URL,
 			config.AppConfig.LLM_MODEL,
-		))
+		),
+	}}
+	names := map[string]bool{config.AppConfig.LLM_PROVIDER: true}
+
+	for _, fallback := range config.AppConfig.LLM_FALLBACKS {
+		if names[fallback.Name] {
+			log.Fatalf("Duplicate LLM provider name: %s, use name:provider in LLM_FALLBACKS", fallback.Name)
+		}
+		names[fallback.Name] = true
+		backends = append(backends, router.Backend{
+			Name:     fallback.Name,
+			Provider: newLLMProvider(fallback.Provider, fallback.APIKey, fallback.BaseURL, fallback.Model),
+		})
+	}
+
+	var provider llm.LLMProvider = router.New(router.Options{
+		MaxRetries:       config.AppConfig.LLM_MAX_RETRIES,
+		Backoff:          time.Duration(config.AppConfig.LLM_RETRY_BACKOFF_MS) * time.Millisecond,
+		MaxBackoff:       10 * time.Second,
+		AttemptTimeout:   time.Duration(config.AppConfig.LLM_ATTEMPT_TIMEOUT) * time.Second,
+		FailureThreshold: config.AppConfig.LLM_BREAKER_THRESHOLD,
+		Cooldown:         time.Duration(config.AppConfig.LLM_BREAKER_COOLDOWN) * time.Second,
+	}, backends...)
+
+	ttl := time.Duration(config.AppConfig.LLM_CACHE_TTL) * time.Second
+	switch config.AppConfig.LLM_CACHE {
+	case "none", "":
+	case "memory":
+		provider = cache.New(provider, cache.NewMemoryStore(config.AppConfig.LLM_CACHE_SIZE), ttl)
+		log.Println("In-memory LLM response cache initialized")
+	case "postgres":
+		provider = cache.New(provider, cache.NewPostgresStore(database.DB), ttl)
+		log.Println("Postgres LLM response cache initialized")
+	default:
+		log.Fatalf("Unsupported LLM cache: %s", config.AppConfig.LLM_CACHE)
+	}
+
+	llm.SetProvider(provider)
+}
+
+// newLLMProvider creates the LLM provider of the given type
+func newLLMProvider(provider, apiKey, baseURL, model string) llm.LLMProvider {
+	switch provider {
+	case "openai":
 		log.Println("OpenAI LLM provider initialized")
+		return openai.NewOpenAIProvider(apiKey, baseURL, model)
 	case "qwen":
-		// qwen support openai client
-		llm.SetProvider(openai.NewOpenAIProvider(
-			config.AppConfig.LLM_API_KEY,
-			config.AppConfig.LLM_BASE_URL,
-			config.AppConfig.LLM_MODEL,
-		))
+		if qwen.IsCompatibleModeURL(baseURL) {
+			// The compatible mode endpoint speaks the OpenAI protocol
+			if model == "" {
+				model = qwen.DefaultModel
+			}
+			log.Println("Qwen LLM provider initialized in OpenAI compatible mode")
+			return openai.NewOpenAIProvider(apiKey, baseURL, model)
+		}
 		log.Println("Qwen LLM provider initialized")
+		return qwen.NewQwenProvider(apiKey, baseURL, model)
+	case "doubao":
+		log.Println("Doubao LLM provider initialized")
+		return doubao.NewDoubaoProvider(apiKey, baseURL, model)
+	case "ollama":
+		log.Println("Ollama LLM provider initialized")
+		return ollama.NewOllamaProvider(apiKey, baseURL, model)
 	default:
-		log.Fatalf("Unsupported LLM provider: %s", config.AppConfig.LLM_PROVIDER)
+		log.Fatalf("Unsupported LLM provider: %s", provider)
+		return nil
+	}
+}
+
+// initEmbeddingProvider initializes the embedding provider used for knowledge retrieval
+func initEmbeddingProvider() {
+	switch config.AppConfig.EMBEDDING_PROVIDER {
+	case "openai":
+		baseURL := config.AppConfig.EMBEDDING_BASE_URL
+		if baseURL == "" && config.AppConfig.LLM_BASE_URL != "" && openAICompatible(config.AppConfig.LLM_PROVIDER, config.AppConfig.LLM_BASE_URL) {
+			// Use the embeddings endpoint next to the configured chat endpoint
+			baseURL = openai.EmbeddingsURL(config.AppConfig.LLM_BASE_URL)
+		}
+		llm.SetEmbeddingProvider(openai.NewOpenAIEmbeddingProvider(
+			config.AppConfig.EMBEDDING_API_KEY,
+			baseURL,
+			config.AppConfig.EMBEDDING_MODEL,
+			config.AppConfig.EMBEDDING_DIMENSIONS,
+		))
+		log.Println("OpenAI embedding provider initialized")
+	case "hashing":
+		llm.SetEmbeddingProvider(hashing.NewHashingEmbedder(
+			config.AppConfig.EMBEDDING_DIMENSIONS,
+		))
+		log.Println("Hashing embedding provider initialized")
+	default:
+		log.Fatalf("Unsupported embedding provider: %s", config.AppConfig.EMBEDDING_PROVIDER)
+	}
+}
+
+// openAICompatible reports whether the LLM provider is called with the OpenAI
+// protocol at baseURL, so its embeddings endpoint is next to the chat one
+func openAICompatible(provider, baseURL string) bool {
+	switch provider {
+	case "openai", "doubao":
+		return true
+	case "qwen":
+		return qwen.IsCompatibleModeURL(baseURL)
 	}
+	return false
 }
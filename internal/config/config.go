@@ -6,10 +6,20 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
+// LLMBackend configures a fallback LLM provider
+type LLMBackend struct {
+	Name     string // route name, also used for the LLM_<NAME>_* variables
+	Provider string
+	BaseURL  string
+	APIKey   string
+	Model    string
+}
+
 type Config struct {
 	DBUser                string
 	DBPassword            string
@@ -34,6 +44,30 @@ type Config struct {
 	LLM_MAX_TOKENS        int
 	LLM_TEMPERATURE       float64
 	LLM_TOP_P             float64
+	LLM_HISTORY_TOKENS    int
+	LLM_FALLBACKS         []LLMBackend // tried in order when LLM_PROVIDER fails
+	LLM_MAX_RETRIES       int
+	LLM_RETRY_BACKOFF_MS  int
+	LLM_ATTEMPT_TIMEOUT   int // seconds
+	LLM_BREAKER_THRESHOLD int
+	LLM_BREAKER_COOLDOWN  int // seconds
+	LLM_CACHE             string
+	LLM_CACHE_TTL         int // seconds
+	LLM_CACHE_SIZE        int
+	LLM_CHAT_TIMEOUT      int // seconds
+	LLM_TOOLS_TIMEOUT     int // seconds
+	LLM_STREAM_TIMEOUT    int // seconds
+	LLM_GENERATE_TIMEOUT  int // seconds
+	LLM_TRANSLATE_TIMEOUT int // seconds
+	LLM_SSE_HEARTBEAT     int // seconds
+	EMBEDDING_PROVIDER    string
+	EMBEDDING_BASE_URL    string
+	EMBEDDING_API_KEY     string
+	EMBEDDING_MODEL       string
+	EMBEDDING_DIMENSIONS  int
+	SEARCH_ALPHA          float64
+	CONTENT_COLLATION     string
+	SCHEDULER_INTERVAL    int // seconds
 }
 
 var AppConfig Config
@@ -65,16 +99,50 @@ func InitConfig() {
 		LLM_BASE_URL:          os.Getenv("LLM_BASE_URL"),
 		LLM_API_KEY:           os.Getenv("LLM_API_KEY"),
 		LLM_MODEL:             os.Getenv("LLM_MODEL"),
-		LLM_MAX_TOKENS:        getEnvAsInt("LLM_MAX_TOKENS", 2048),   // default value for max_tokens is 2048, you can change it to your own requiremen
-		LLM_TEMPERATURE:       getEnvAsFloat("LLM_TEMPERATURE", 0.7), // default value for temperature is 0.7
-		LLM_TOP_P:             getEnvAsFloat("LLM_TOP_P", 1),         // default value for top_p is 1
+		LLM_MAX_TOKENS:        getEnvAsInt("LLM_MAX_TOKENS", 2048),     // default value for max_tokens is 2048, you can change it to your own requiremen
+		LLM_TEMPERATURE:       getEnvAsFloat("LLM_TEMPERATURE", 0.7),   // default value for temperature is 0.7
+		LLM_TOP_P:             getEnvAsFloat("LLM_TOP_P", 1),           // default value for top_p is 1
+		LLM_HISTORY_TOKENS:    getEnvAsInt("LLM_HISTORY_TOKENS", 4096), // token budget for conversation history, 0 disables truncation
+		LLM_FALLBACKS:         getLLMFallbacks("LLM_FALLBACKS"),
+		LLM_MAX_RETRIES:       getEnvAsInt("LLM_MAX_RETRIES", 2),         // retries on the same provider for rate limits and server errors
+		LLM_RETRY_BACKOFF_MS:  getEnvAsInt("LLM_RETRY_BACKOFF_MS", 500),  // wait before the first retry, doubled for every further retry
+		LLM_ATTEMPT_TIMEOUT:   getEnvAsInt("LLM_ATTEMPT_TIMEOUT", 20),    // seconds a provider gets before the next one is tried, 0 means no limit
+		LLM_BREAKER_THRESHOLD: getEnvAsInt("LLM_BREAKER_THRESHOLD", 5),   // consecutive failures before a provider is skipped, 0 disables the breaker
+		LLM_BREAKER_COOLDOWN:  getEnvAsInt("LLM_BREAKER_COOLDOWN", 30),   // seconds a failing provider is skipped
+		LLM_CACHE:             getEnv("LLM_CACHE", "none"),               // none, memory or postgres
+		LLM_CACHE_TTL:         getEnvAsInt("LLM_CACHE_TTL", 3600),        // seconds a cached response is reused
+		LLM_CACHE_SIZE:        getEnvAsInt("LLM_CACHE_SIZE", 1000),       // responses kept by the memory cache
+		LLM_CHAT_TIMEOUT:      getEnvAsInt("LLM_CHAT_TIMEOUT", 30),       // seconds for a chat, knowledge or template request
+		LLM_TOOLS_TIMEOUT:     getEnvAsInt("LLM_TOOLS_TIMEOUT", 90),      // seconds for a chat with tool calls, which takes several round trips
+		LLM_STREAM_TIMEOUT:    getEnvAsInt("LLM_STREAM_TIMEOUT", 60),     // seconds a streamed reply may take
+		LLM_GENERATE_TIMEOUT:  getEnvAsInt("LLM_GENERATE_TIMEOUT", 60),   // seconds for generating a field value or a schema
+		LLM_TRANSLATE_TIMEOUT: getEnvAsInt("LLM_TRANSLATE_TIMEOUT", 120), // seconds for translating a content entry
+		LLM_SSE_HEARTBEAT:     getEnvAsInt("LLM_SSE_HEARTBEAT", 15),      // seconds between keep-alive comments in streams, 0 disables them
+		EMBEDDING_PROVIDER:    getEnv("EMBEDDING_PROVIDER", "openai"),
+		EMBEDDING_BASE_URL:    os.Getenv("EMBEDDING_BASE_URL"),
+		EMBEDDING_API_KEY:     getEnv("EMBEDDING_API_KEY", os.Getenv("LLM_API_KEY")), // reuse the LLM key by default
+		EMBEDDING_MODEL:       os.Getenv("EMBEDDING_MODEL"),
+		EMBEDDING_DIMENSIONS:  getEnvAsInt("EMBEDDING_DIMENSIONS", 0), // 0 means the model's native size
+		SEARCH_ALPHA:          getEnvAsFloat("SEARCH_ALPHA", 0.5),     // weight of semantic similarity in content search
+		CONTENT_COLLATION:     os.Getenv("CONTENT_COLLATION"),         // collation for sorting text fields, empty for the database default
+		SCHEDULER_INTERVAL:    getEnvAsInt("SCHEDULER_INTERVAL", 30),  // seconds between checks for scheduled publishing, 0 disables the scheduler
 	}
 
 	models.SetSecret(AppConfig.JWTSecret)
+	if err := models.SetSortCollation(AppConfig.CONTENT_COLLATION); err != nil {
+		log.Fatal("Invalid CONTENT_COLLATION: ", err)
+	}
 
 	logger.Info("Configuration loaded successfully!")
 }
 
+func getEnv(name string, defaultVal string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultVal
+}
+
 func getEnvAsInt(name string, defaultVal int) int {
 	valueStr := os.Getenv(name)
 	if value, err := strconv.Atoi(valueStr); err == nil {
@@ -90,3 +158,31 @@ func getEnvAsFloat(name string, defaultVal float64) float64 {
 	}
 	return defaultVal
 }
+
+// getLLMFallbacks parses a comma separated list of fallback providers. An entry
+// is a provider name, or name:provider to use one provider more than once.
+// Each fallback reads its settings from LLM_<NAME>_BASE_URL, LLM_<NAME>_API_KEY
+// and LLM_<NAME>_MODEL.
+func getLLMFallbacks(name string) []LLMBackend {
+	var backends []LLMBackend
+	for _, entry := range strings.Split(os.Getenv(name), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		backendName, provider, found := strings.Cut(entry, ":")
+		if !found {
+			provider = backendName
+		}
+		prefix := "LLM_" + strings.ToUpper(strings.ReplaceAll(backendName, "-", "_")) + "_"
+		backends = append(backends, LLMBackend{
+			Name:     backendName,
+			Provider: provider,
+			BaseURL:  os.Getenv(prefix + "BASE_URL"),
+			APIKey:   os.Getenv(prefix + "API_KEY"),
+			Model:    os.Getenv(prefix + "MODEL"),
+		})
+	}
+	return backends
+}
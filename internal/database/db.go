@@ -112,10 +112,32 @@ func RunMigrations() error {
 		&models.ContentEntry{},
 		&models.Media{},
 		&models.ContentVersion{},
+		&models.ContentEmbedding{},
+		&models.ContentIndexState{},
+		&models.Conversation{},
+		&models.Message{},
+		&models.LLMUsage{},
+		&models.PromptTemplate{},
+		&models.LLMCacheEntry{},
+		&models.ContentRelation{},
 	); err != nil {
 		logger.GeneralAction(fmt.Sprintf("Error migrating database: %v", err))
 		return err
 	}
+	for _, statement := range models.SortFunctionsSQL {
+		if err := DB.Exec(statement).Error; err != nil {
+			logger.GeneralAction(fmt.Sprintf("Error creating sort functions: %v", err))
+			return err
+		}
+	}
+	if err := DB.Exec(models.RelationIndexesSQL).Error; err != nil {
+		logger.GeneralAction(fmt.Sprintf("Error creating relation indexes: %v", err))
+		return err
+	}
+	if err := models.BackfillRelations(DB); err != nil {
+		logger.GeneralAction(fmt.Sprintf("Error linking existing relations: %v", err))
+		return err
+	}
 	logger.GeneralAction("Database migration completed")
 	return nil
 }
@@ -17,6 +17,9 @@ func CreateAPIUser(c *fiber.Ctx) error {
 		Status      models.APIUserStatus `json:"status"`
 		Scopes      pq.StringArray       `json:"scopes"`
 		Description string               `json:"description"`
+		// LLM token quotas, 0 means unlimited
+		DailyTokenQuota   int64 `json:"daily_token_quota"`
+		MonthlyTokenQuota int64 `json:"monthly_token_quota"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -42,6 +45,13 @@ func CreateAPIUser(c *fiber.Ctx) error {
 		})
 	}
 
+	if input.DailyTokenQuota < 0 || input.MonthlyTokenQuota < 0 {
+		logger.Error("Invalid token quota")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Token quotas cannot be negative",
+		})
+	}
+
 	// Check if the name is unique
 	var existingAPIUser models.APIUser
 	if err := database.DB.Where("name = ?", input.Name).First(&existingAPIUser).Error; err == nil {
@@ -60,11 +70,13 @@ func CreateAPIUser(c *fiber.Ctx) error {
 
 	// Generate a new API user
 	apiUser := models.APIUser{
-		Name:        input.Name,
-		ExpireAt:    input.ExpireAt,
-		Status:      input.Status,
-		Scopes:      input.Scopes,
-		Description: input.Description,
+		Name:              input.Name,
+		ExpireAt:          input.ExpireAt,
+		Status:            input.Status,
+		Scopes:            input.Scopes,
+		Description:       input.Description,
+		DailyTokenQuota:   input.DailyTokenQuota,
+		MonthlyTokenQuota: input.MonthlyTokenQuota,
 		//	Token will be generated by BeforeCreate hook
 	}
 
@@ -123,6 +135,9 @@ func UpdateAPIUser(c *fiber.Ctx) error {
 		Status      *models.APIUserStatus `json:"status"`
 		Scopes      *pq.StringArray       `json:"scopes"`
 		Description *string               `json:"description"`
+		// LLM token quotas, 0 means unlimited
+		DailyTokenQuota   *int64 `json:"daily_token_quota"`
+		MonthlyTokenQuota *int64 `json:"monthly_token_quota"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -186,6 +201,26 @@ func UpdateAPIUser(c *fiber.Ctx) error {
 		apiUser.Description = *input.Description
 	}
 
+	if input.DailyTokenQuota != nil {
+		if *input.DailyTokenQuota < 0 {
+			logger.Error("Invalid daily token quota")
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Token quotas cannot be negative",
+			})
+		}
+		apiUser.DailyTokenQuota = *input.DailyTokenQuota
+	}
+
+	if input.MonthlyTokenQuota != nil {
+		if *input.MonthlyTokenQuota < 0 {
+			logger.Error("Invalid monthly token quota")
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Token quotas cannot be negative",
+			})
+		}
+		apiUser.MonthlyTokenQuota = *input.MonthlyTokenQuota
+	}
+
 	if err := database.DB.Save(&apiUser).Error; err != nil {
 		logger.Error("Failed to update API user: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -4,15 +4,19 @@ import (
 	"contentive/internal/database"
 	"contentive/internal/logger"
 	"contentive/internal/models"
+	"contentive/internal/rag"
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 func isValidContentSlug(slug string) bool {
@@ -21,13 +25,20 @@ func isValidContentSlug(slug string) bool {
 		!strings.Contains(slug, "_")
 }
 
+// reservedContentSlugs are path segments of routes next to the content slug
+// routes, so an entry with one of them as slug could not be fetched by slug
+var reservedContentSlugs = map[string]bool{
+	"search": true,
+}
+
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
 
 // validateContentData validates the content data against the schema fields
 func validateContentData(data map[string]interface{}, fields []models.FieldDefinition) error {
 	for _, field := range fields {
 		value, exists := data[field.Name]
-		if !exists {
+		// A null value is no value, as left by a deleted reference
+		if !exists || value == nil {
 			if field.Required {
 				return fmt.Errorf("required field %s is missing", field.Name)
 			}
@@ -87,6 +98,9 @@ func validateContentData(data map[string]interface{}, fields []models.FieldDefin
 			if field.Type == models.FieldTypeDate {
 				layout = "2006-01-02"
 			} else {
+				// Keep this strict: the sort indexes convert datetimes with
+				// content_timestamptz, declared IMMUTABLE in models.SortFunctionsSQL,
+				// which only holds for values that carry their offset
 				layout = time.RFC3339 // ISO 8601 format
 			}
 
@@ -112,8 +126,9 @@ func validateContentData(data map[string]interface{}, fields []models.FieldDefin
 			if !ok {
 				return fmt.Errorf("field '%s' must be a string", field.Name)
 			}
-			// Check if the value is in the options list
-			if options, exists := field.Options["options"]; exists {
+			// Check if the value is in the choices list, the option schemas are
+			// validated to have
+			if options, exists := field.Options["choices"]; exists {
 				if optionsList, ok := options.([]interface{}); ok {
 					valid := false
 					for _, opt := range optionsList {
@@ -129,9 +144,16 @@ func validateContentData(data map[string]interface{}, fields []models.FieldDefin
 			}
 
 		case models.FieldTypeRelation:
-			strVal, ok := value.(string)
-			if !ok {
-				return fmt.Errorf("field '%s' must be a string (slug of the related content)", field.Name)
+			// To-one fields hold a slug, to-many fields a list of slugs
+			slugs, err := field.RelationSlugs(value)
+			if err != nil {
+				return err
+			}
+			if len(slugs) == 0 {
+				if field.Required {
+					return fmt.Errorf("required field %s must link at least one entry", field.Name)
+				}
+				continue
 			}
 
 			targetSchema, ok := field.Options["targetSchema"]
@@ -150,9 +172,16 @@ func validateContentData(data map[string]interface{}, fields []models.FieldDefin
 			}
 
 			// Check if the target schema content exists
-			var contentEntry models.ContentEntry
-			if err := database.DB.Where("content_type_id = ? AND slug = ?", targetSchemaModel.ID, strVal).First(&contentEntry).Error; err != nil {
-				return fmt.Errorf("field '%s' references non-existent content '%s' in schema '%s'", field.Name, strVal, targetSchemaStr)
+			var found []string
+			if err := database.DB.Model(&models.ContentEntry{}).
+				Where("content_type_id = ? AND slug IN ?", targetSchemaModel.ID, slugs).
+				Pluck("slug", &found).Error; err != nil {
+				return fmt.Errorf("field '%s' could not be checked: %v", field.Name, err)
+			}
+			for _, slug := range slugs {
+				if !slices.Contains(found, slug) {
+					return fmt.Errorf("field '%s' references non-existent content '%s' in schema '%s'", field.Name, slug, targetSchemaStr)
+				}
 			}
 
 		case models.FieldTypeMedia:
@@ -275,6 +304,12 @@ func CreateContent(c *fiber.Ctx) error {
 			"error": "Invalid slug format, must be lowercase, no spaces or underscores",
 		})
 	}
+	if reservedContentSlugs[input.Slug] {
+		logger.Error("Slug %s is reserved", input.Slug)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Slug '%s' is reserved", input.Slug),
+		})
+	}
 
 	// Check if slug already exists
 	var existingContent models.ContentEntry
@@ -377,6 +412,11 @@ func CreateContent(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := models.SyncRelations(tx, content, fileds); err != nil {
+		tx.Rollback()
+		return relationErrorResponse(c, err)
+	}
+
 	contentVersion := models.ContentVersion{
 		ID:             uuid.New(),
 		ContentEntryID: content.ID,
@@ -434,10 +474,13 @@ func CreateContent(c *fiber.Ctx) error {
 type ContentQuery struct {
 	Page     int    `query:"page"`
 	PageSize int    `query:"page_size"`
-	OrderBy  string `query:"order_by"` // field name such as "created_at" "updated_at" "published_at
-	Order    string `query:"order"`    // asc or desc
+	OrderBy  string `query:"order_by"` // comma separated columns or schema fields, e.g. "category,-price"
+	Order    string `query:"order"`    // asc or desc, for the keys without a "-" prefix
 	Search   string `query:"search"`   // search query
 	Status   string `query:"status"`   // is_published or not
+	Cursor   string `query:"cursor"`   // keyset cursor, an empty cursor starts at the first page
+	Count    string `query:"count"`    // whether to count the entries, true by default for pages and false for cursors
+	Include  string `query:"include"`  // relation and media fields to populate, e.g. "author,category.parent"
 }
 
 // GetContent gets all content entries for a given schema
@@ -461,6 +504,20 @@ func GetContent(c *fiber.Ctx) error {
 		})
 	}
 
+	filters, err := parseContentFilters(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	include, err := parseInclude(query.Include)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	if query.Page <= 0 {
 		query.Page = 1
 	}
@@ -470,20 +527,6 @@ func GetContent(c *fiber.Ctx) error {
 		query.PageSize = 100
 	}
 
-	// Check if orderBy is valid
-	allowedOrderBy := map[string]bool{"created_at": true, "updated_at": true, "slug": true}
-	if query.OrderBy == "" {
-		query.OrderBy = "created_at"
-	} else if !allowedOrderBy[query.OrderBy] {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid orderBy parameter",
-		})
-	}
-
-	if query.Order != "asc" && query.Order != "desc" {
-		query.Order = "desc"
-	}
-
 	// Check if schema exists
 	var schema models.Schema
 	if err := database.DB.Where("id =?", schemaID).First(&schema).Error; err != nil {
@@ -514,17 +557,126 @@ func GetContent(c *fiber.Ctx) error {
 		db = db.Where("slug LIKE ? OR data::text LIKE ?", searchPattern, searchPattern)
 	}
 
-	var total int64
-	if err := db.Count(&total).Error; err != nil {
-		logger.Error("Error counting content entries: %v", err)
+	var fields []models.FieldDefinition
+	if err := json.Unmarshal(schema.Fields, &fields); err != nil {
+		logger.Error("Error unmarshalling schema fields: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to count content entries",
+			"error": "Internal server error",
+		})
+	}
+
+	db, err = applyContentFilters(db, filters, fields)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if query.OrderBy == "" {
+		query.OrderBy = "created_at"
+	}
+	keys, err := contentSortKeys(query.OrderBy, query.Order, fields)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// A cursor parameter, even an empty one, switches to keyset pagination
+	useCursor := c.Context().QueryArgs().Has("cursor")
+	var cursor *pageCursor
+	if query.Cursor != "" {
+		cursor, err = decodeCursor(query.Cursor, keys)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	count := !useCursor
+	if query.Count != "" {
+		count, err = strconv.ParseBool(query.Count)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "count must be true or false",
+			})
+		}
+	}
+
+	var total int64
+	if count {
+		if err := db.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			logger.Error("Error counting content entries: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to count content entries",
+			})
+		}
+	}
+
+	queryInfo := fiber.Map{
+		"order_by": query.OrderBy,
+		"order":    query.Order,
+		"search":   query.Search,
+		"status":   query.Status,
+		"filters":  filters,
+	}
+
+	if useCursor {
+		var content []models.ContentEntry
+		if err := keysetPage(db, keys, cursor, query.PageSize).Find(&content).Error; err != nil {
+			logger.Error("Failed to get content: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get content",
+			})
+		}
+
+		hasMore := len(content) > query.PageSize
+		if hasMore {
+			content = content[:query.PageSize]
+		}
+		if cursor != nil && cursor.Before {
+			slices.Reverse(content)
+		}
+
+		if err := populateContent(c, schema, content, include); err != nil {
+			return includeErrorResponse(c, err)
+		}
+
+		pagination := fiber.Map{
+			"page_size":   query.PageSize,
+			"next_cursor": nil,
+			"prev_cursor": nil,
+		}
+		if len(content) > 0 {
+			next, prev, err := keysetCursors(database.DB, &models.ContentEntry{}, keys, cursor, hasMore, content[0].ID, content[len(content)-1].ID)
+			if err != nil {
+				logger.Error("Failed to build content cursors: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to get content",
+				})
+			}
+			if next != "" {
+				pagination["next_cursor"] = next
+			}
+			if prev != "" {
+				pagination["prev_cursor"] = prev
+			}
+		}
+		if count {
+			pagination["total"] = total
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"data":       content,
+			"pagination": pagination,
+			"query":      queryInfo,
 		})
 	}
 
 	offset := (query.Page - 1) * query.PageSize
 	var content []models.ContentEntry
-	if err := db.Order(fmt.Sprintf("%s %s", query.OrderBy, query.Order)).
+	if err := db.Order(orderClause(keys, false)).
 		Offset(offset).
 		Limit(query.PageSize).
 		Find(&content).Error; err != nil {
@@ -534,22 +686,23 @@ func GetContent(c *fiber.Ctx) error {
 		})
 	}
 
-	totalPages := (total + int64(query.PageSize) - 1) / int64(query.PageSize)
+	if err := populateContent(c, schema, content, include); err != nil {
+		return includeErrorResponse(c, err)
+	}
+
+	pagination := fiber.Map{
+		"current_page": query.Page,
+		"page_size":    query.PageSize,
+	}
+	if count {
+		pagination["total_pages"] = (total + int64(query.PageSize) - 1) / int64(query.PageSize)
+		pagination["total"] = total
+	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"data": content,
-		"pagination": fiber.Map{
-			"current_page": query.Page,
-			"page_size":    query.PageSize,
-			"total_pages":  totalPages,
-			"total":        total,
-		},
-		"query": fiber.Map{
-			"order_by": query.OrderBy,
-			"order":    query.Order,
-			"search":   query.Search,
-			"status":   query.Status,
-		},
+		"data":       content,
+		"pagination": pagination,
+		"query":      queryInfo,
 	})
 }
 
@@ -557,6 +710,14 @@ func GetContent(c *fiber.Ctx) error {
 func GetContentById(c *fiber.Ctx) error {
 	schemaID := c.Params("schema_id")
 	contentID := c.Params("content_id")
+
+	include, err := parseInclude(c.Query("include"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	// Check if schema exists
 	var schema models.Schema
 	if err := database.DB.Where("id =?", schemaID).First(&schema).Error; err != nil {
@@ -573,7 +734,12 @@ func GetContentById(c *fiber.Ctx) error {
 			"error": "Content not found",
 		})
 	}
-	return c.Status(fiber.StatusOK).JSON(content)
+
+	entries := []models.ContentEntry{content}
+	if err := populateContent(c, schema, entries, include); err != nil {
+		return includeErrorResponse(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(entries[0])
 }
 
 // GetContentBySlug gets a content entry by slug
@@ -596,7 +762,18 @@ func GetContentBySlug(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(content)
+	include, err := parseInclude(c.Query("include"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	entries := []models.ContentEntry{content}
+	if err := populateContent(c, schema, entries, include); err != nil {
+		return includeErrorResponse(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(entries[0])
 }
 
 // UpdateContent updates an existing content entry for a given schema
@@ -656,6 +833,12 @@ func UpdateContent(c *fiber.Ctx) error {
 				"error": "Invalid slug format, must be lowercase, no spaces or underscores",
 			})
 		}
+		if reservedContentSlugs[input.Slug] && input.Slug != existingContent.Slug {
+			logger.Error("Slug %s is reserved", input.Slug)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Slug '%s' is reserved", input.Slug),
+			})
+		}
 
 		// Check if new slug already exists (excluding current content)
 		if err := database.DB.Where("slug = ? AND content_type_id = ? AND id != ?", input.Slug, schemaID, contentID).
@@ -752,6 +935,7 @@ func UpdateContent(c *fiber.Ctx) error {
 	existingContent.UpdatedBy = &userID
 	existingContent.CurrentVersion += 1
 
+	oldSlug := existingContent.Slug
 	if input.Slug != "" {
 		existingContent.Slug = input.Slug
 	}
@@ -767,6 +951,27 @@ func UpdateContent(c *fiber.Ctx) error {
 		})
 	}
 
+	if input.Data != nil {
+		if err := models.SyncRelations(tx, existingContent, fields); err != nil {
+			tx.Rollback()
+			return relationErrorResponse(c, err)
+		}
+	}
+
+	// Entries linking to the content store its slug
+	var renamedLinks []uuid.UUID
+	if existingContent.Slug != oldSlug {
+		var err error
+		renamedLinks, err = models.RenameRelationTarget(tx, existingContent.ID, oldSlug, existingContent.Slug, userType, userID)
+		if err != nil {
+			tx.Rollback()
+			logger.Error("Failed to update the entries linking to the content: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update content",
+			})
+		}
+	}
+
 	// Create new content version
 	contentVersion := models.ContentVersion{
 		ID:             uuid.New(),
@@ -793,6 +998,12 @@ func UpdateContent(c *fiber.Ctx) error {
 		})
 	}
 
+	// Refresh the knowledge index in the background
+	rag.Enqueue(existingContent.ID)
+	for _, id := range renamedLinks {
+		rag.Enqueue(id)
+	}
+
 	// Log the action
 	if userType == models.ContentEntryUserByTypeAdmin {
 		adminUser := currentUser.(models.AdminUser)
@@ -898,10 +1109,16 @@ func PublishContent(c *fiber.Ctx) error {
 		now := time.Now()
 		content.PublishedAt = &now
 		content.PublishedBy = &userID
+		// Publishing now replaces a scheduled publish
+		content.PublishAt = nil
 	} else {
 		// Clear publish information when unpublishing
 		content.PublishedAt = nil
 		content.PublishedBy = nil
+		content.UnpublishAt = nil
+	}
+	if content.PublishAt == nil && content.UnpublishAt == nil {
+		content.ScheduledBy = nil
 	}
 
 	// Save the updated content
@@ -912,6 +1129,9 @@ func PublishContent(c *fiber.Ctx) error {
 		})
 	}
 
+	// Refresh the knowledge index in the background
+	rag.Enqueue(content.ID)
+
 	// Log the action
 	action := "PUBLISH_CONTENT"
 	actionDesc := "Published content"
@@ -1021,8 +1241,35 @@ func DeleteContent(c *fiber.Ctx) error {
 		})
 	}
 
+	// Apply the onDelete policies of the fields referring to the content
+	plan, err := models.PlanContentDelete(tx, []uuid.UUID{content.ID})
+	if err != nil {
+		tx.Rollback()
+		logger.Error("Failed to find references to content: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete content",
+		})
+	}
+	if len(plan.Restrict) > 0 {
+		tx.Rollback()
+		logger.Warning("Content %s is referenced by %d entries, not deleted", content.Slug, len(plan.Restrict))
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":      "Content is referenced by other entries",
+			"references": plan.Restrict,
+		})
+	}
+
+	if missing := missingDeleteScopes(currentUser, plan); len(missing) > 0 {
+		tx.Rollback()
+		logger.Warning("Content %s not deleted, the API user lacks %v for its cascades", content.Slug, missing)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":          "Insufficient permissions for the entries the delete changes",
+			"missing_scopes": missing,
+		})
+	}
+
 	// Delete the content
-	if err := tx.Delete(&content).Error; err != nil {
+	if err := plan.Apply(tx, userType, userID); err != nil {
 		tx.Rollback()
 		logger.Error("Failed to delete content: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -1036,14 +1283,14 @@ func DeleteContent(c *fiber.Ctx) error {
 			userID,
 			userName,
 			"DELETE_CONTENT",
-			"Deleted content for schema: "+schema.Name+" with slug: "+content.Slug,
+			"Deleted content for schema: "+schema.Name+" with slug: "+content.Slug+deletePlanSummary(plan),
 		)
 	} else {
 		logger.APIAction(
 			userID,
 			userName,
 			"DELETE_CONTENT",
-			"Deleted content for schema: "+schema.Name+" with slug: "+content.Slug,
+			"Deleted content for schema: "+schema.Name+" with slug: "+content.Slug+deletePlanSummary(plan),
 		)
 	}
 
@@ -1056,8 +1303,14 @@ func DeleteContent(c *fiber.Ctx) error {
 		})
 	}
 
+	// Drop the deleted content from the knowledge index, and refresh the
+	// entries whose references were cleared
+	enqueueDeletePlan(plan)
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Content deleted successfully",
-		"content": content,
+		"message":  "Content deleted successfully",
+		"content":  content,
+		"cascaded": plan.Cascade,
+		"cleared":  plan.SetNull,
 	})
 }
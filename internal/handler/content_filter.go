@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"contentive/internal/models"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Filter operators of the filter[field][op]=value query parameters
+const (
+	FilterEq       = "eq"
+	FilterNe       = "ne"
+	FilterLt       = "lt"
+	FilterGt       = "gt"
+	FilterIn       = "in"       // comma separated values
+	FilterContains = "contains" // substring of a text, or an item of a media list
+	FilterExists   = "exists"   // true or false
+	FilterBetween  = "between"  // two comma separated values, both included
+)
+
+const (
+	maxContentFilters = 20
+	maxFilterValues   = 100
+)
+
+// filterParamRegex matches filter[field] and filter[field][op]
+var filterParamRegex = regexp.MustCompile(`^filter\[([^\[\]]+)\](?:\[([a-z]+)\])?$`)
+
+// filterOperators lists the operators each field type can be filtered with.
+// Password fields cannot be filtered.
+var filterOperators = map[models.FieldType][]string{
+	models.FieldTypeText:      {FilterEq, FilterNe, FilterIn, FilterContains, FilterExists},
+	models.FieldTypeTextarea:  {FilterEq, FilterNe, FilterIn, FilterContains, FilterExists},
+	models.FieldTypeRichText:  {FilterEq, FilterNe, FilterIn, FilterContains, FilterExists},
+	models.FieldTypeEmail:     {FilterEq, FilterNe, FilterIn, FilterContains, FilterExists},
+	models.FieldTypeSelect:    {FilterEq, FilterNe, FilterIn, FilterExists},
+	models.FieldTypeRelation:  {FilterEq, FilterNe, FilterIn, FilterExists},
+	models.FieldTypeMedia:     {FilterEq, FilterNe, FilterIn, FilterExists},
+	models.FieldTypeMediaList: {FilterContains, FilterExists},
+	models.FieldTypeNumber:    {FilterEq, FilterNe, FilterLt, FilterGt, FilterIn, FilterBetween, FilterExists},
+	models.FieldTypeDate:      {FilterEq, FilterNe, FilterLt, FilterGt, FilterIn, FilterBetween, FilterExists},
+	models.FieldTypeDateTime:  {FilterEq, FilterNe, FilterLt, FilterGt, FilterIn, FilterBetween, FilterExists},
+	models.FieldTypeBoolean:   {FilterEq, FilterNe, FilterExists},
+}
+
+// ContentFilter is one filter on a field of the content data
+type ContentFilter struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+// parseContentFilters reads the filter parameters of the query string.
+// filter[field]=value is short for filter[field][eq]=value.
+func parseContentFilters(c *fiber.Ctx) ([]ContentFilter, error) {
+	var filters []ContentFilter
+	var err error
+	c.Context().QueryArgs().VisitAll(func(key, value []byte) {
+		if err != nil || !strings.HasPrefix(string(key), "filter") {
+			return
+		}
+		m := filterParamRegex.FindStringSubmatch(string(key))
+		if m == nil {
+			err = fmt.Errorf("invalid filter parameter '%s', use filter[field][operator]=value", key)
+			return
+		}
+		op := m[2]
+		if op == "" {
+			op = FilterEq
+		}
+		filters = append(filters, ContentFilter{Field: m[1], Op: op, Value: string(value)})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(filters) > maxContentFilters {
+		return nil, fmt.Errorf("at most %d filters are allowed", maxContentFilters)
+	}
+	return filters, nil
+}
+
+// applyContentFilters checks the filters against the schema fields and adds
+// them to the query as JSONB predicates on the content data
+func applyContentFilters(db *gorm.DB, filters []ContentFilter, fields []models.FieldDefinition) (*gorm.DB, error) {
+	if len(filters) == 0 {
+		return db, nil
+	}
+
+	fieldsByName := make(map[string]models.FieldDefinition, len(fields))
+	for _, field := range fields {
+		fieldsByName[field.Name] = field
+	}
+
+	for _, filter := range filters {
+		field, exists := fieldsByName[filter.Field]
+		if !exists {
+			return nil, fmt.Errorf("unknown filter field '%s'", filter.Field)
+		}
+		clause, args, err := filterClause(field, filter.Op, filter.Value)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(clause, args...)
+	}
+	return db, nil
+}
+
+// filterClause translates a filter into a predicate. Field names and values
+// are always bound as parameters.
+func filterClause(field models.FieldDefinition, op string, raw string) (string, []interface{}, error) {
+	supported := false
+	for _, allowed := range filterOperators[field.Type] {
+		if allowed == op {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		if len(filterOperators[field.Type]) == 0 {
+			return "", nil, fmt.Errorf("field '%s' cannot be filtered", field.Name)
+		}
+		return "", nil, fmt.Errorf("operator '%s' is not supported for %s field '%s', use one of: %s",
+			op, field.Type, field.Name, strings.Join(filterOperators[field.Type], ", "))
+	}
+
+	switch op {
+	case FilterExists:
+		exists, err := strconv.ParseBool(raw)
+		if err != nil {
+			return "", nil, fmt.Errorf("filter exists on '%s' must be true or false", field.Name)
+		}
+		// A JSON null counts as missing
+		clause := "COALESCE(jsonb_typeof(data -> CAST(? AS text)), 'null') <> 'null'"
+		if !exists {
+			clause = "COALESCE(jsonb_typeof(data -> CAST(? AS text)), 'null') = 'null'"
+		}
+		return clause, []interface{}{field.Name}, nil
+
+	case FilterContains:
+		if field.Type == models.FieldTypeMediaList {
+			item, _ := json.Marshal([]string{raw})
+			return "data -> CAST(? AS text) @> CAST(? AS jsonb)", []interface{}{field.Name, string(item)}, nil
+		}
+		if raw == "" {
+			return "", nil, fmt.Errorf("filter contains on '%s' needs a value", field.Name)
+		}
+		return `data ->> CAST(? AS text) ILIKE ?`, []interface{}{field.Name, "%" + escapeLike(raw) + "%"}, nil
+	}
+
+	values := []string{raw}
+	switch op {
+	case FilterIn:
+		values = strings.Split(raw, ",")
+		if len(values) > maxFilterValues {
+			return "", nil, fmt.Errorf("filter in on '%s' allows at most %d values", field.Name, maxFilterValues)
+		}
+	case FilterBetween:
+		values = strings.Split(raw, ",")
+		if len(values) != 2 {
+			return "", nil, fmt.Errorf("filter between on '%s' needs two comma separated values", field.Name)
+		}
+	}
+
+	typed := make([]interface{}, len(values))
+	for i, value := range values {
+		v, err := filterValue(field, strings.TrimSpace(value))
+		if err != nil {
+			return "", nil, err
+		}
+		typed[i] = v
+	}
+
+	// Numbers and dates are compared as values, a stored value of another
+	// JSON type never matches. Dates and datetimes are converted by the
+	// functions of models.SortFunctionsSQL, which turn values in another
+	// format, as left by a change of field type, into NULL.
+	var expr string
+	switch field.Type {
+	case models.FieldTypeNumber:
+		expr = "(CASE WHEN jsonb_typeof(data -> CAST(? AS text)) = 'number' THEN CAST(data ->> CAST(? AS text) AS numeric) END)"
+	case models.FieldTypeDate:
+		expr = "(CASE WHEN jsonb_typeof(data -> CAST(? AS text)) = 'string' THEN content_date(data ->> CAST(? AS text)) END)"
+	case models.FieldTypeDateTime:
+		expr = "(CASE WHEN jsonb_typeof(data -> CAST(? AS text)) = 'string' THEN content_timestamptz(data ->> CAST(? AS text)) END)"
+	}
+
+	if expr == "" {
+		// Everything else is matched by containment, which the GIN index on the data serves
+		contains := make([]string, len(typed))
+		args := make([]interface{}, len(typed))
+		for i, v := range typed {
+			if field.Type == models.FieldTypeRelation && field.ToMany() {
+				// A to-many relation matches when its list holds the slug
+				v = []interface{}{v}
+			}
+			document, _ := json.Marshal(map[string]interface{}{field.Name: v})
+			contains[i] = "data @> CAST(? AS jsonb)"
+			args[i] = string(document)
+		}
+		clause := "(" + strings.Join(contains, " OR ") + ")"
+		if op == FilterNe {
+			clause = "NOT " + clause
+		}
+		return clause, args, nil
+	}
+
+	args := []interface{}{field.Name, field.Name}
+	switch op {
+	case FilterEq:
+		return expr + " = ?", append(args, typed[0]), nil
+	case FilterNe:
+		// Entries without the field are not equal either
+		return "(" + expr + " = ?) IS NOT TRUE", append(args, typed[0]), nil
+	case FilterLt:
+		return expr + " < ?", append(args, typed[0]), nil
+	case FilterGt:
+		return expr + " > ?", append(args, typed[0]), nil
+	case FilterBetween:
+		return expr + " BETWEEN ? AND ?", append(args, typed...), nil
+	default: // FilterIn
+		return expr + " IN ?", append(args, typed), nil
+	}
+}
+
+// filterValue converts a filter value to the type of the field
+func filterValue(field models.FieldDefinition, value string) (interface{}, error) {
+	switch field.Type {
+	case models.FieldTypeNumber:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("filter value '%s' for '%s' must be a number", value, field.Name)
+		}
+		return number, nil
+	case models.FieldTypeBoolean:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("filter value '%s' for '%s' must be true or false", value, field.Name)
+		}
+		return b, nil
+	case models.FieldTypeDate:
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return nil, fmt.Errorf("filter value '%s' for '%s' must be a date in YYYY-MM-DD format", value, field.Name)
+		}
+		return value, nil
+	case models.FieldTypeDateTime:
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("filter value '%s' for '%s' must be a datetime in ISO 8601 format", value, field.Name)
+		}
+		return t, nil
+	default:
+		return value, nil
+	}
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
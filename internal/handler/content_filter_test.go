@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"contentive/internal/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	numberExpr   = "(CASE WHEN jsonb_typeof(data -> CAST(? AS text)) = 'number' THEN CAST(data ->> CAST(? AS text) AS numeric) END)"
+	dateExpr     = "(CASE WHEN jsonb_typeof(data -> CAST(? AS text)) = 'string' THEN content_date(data ->> CAST(? AS text)) END)"
+	datetimeExpr = "(CASE WHEN jsonb_typeof(data -> CAST(? AS text)) = 'string' THEN content_timestamptz(data ->> CAST(? AS text)) END)"
+)
+
+func filterField(name string, fieldType models.FieldType, options map[string]interface{}) models.FieldDefinition {
+	return models.FieldDefinition{Name: name, Type: fieldType, Options: options}
+}
+
+func TestFilterClause(t *testing.T) {
+	title := filterField("title", models.FieldTypeText, nil)
+	status := filterField("status", models.FieldTypeSelect, map[string]interface{}{"choices": []interface{}{"draft", "live"}})
+	author := filterField("author", models.FieldTypeRelation, map[string]interface{}{"relationType": "many-to-one"})
+	tags := filterField("tags", models.FieldTypeRelation, map[string]interface{}{"relationType": "many-to-many"})
+	gallery := filterField("gallery", models.FieldTypeMediaList, nil)
+	price := filterField("price", models.FieldTypeNumber, nil)
+	day := filterField("day", models.FieldTypeDate, nil)
+	at := filterField("at", models.FieldTypeDateTime, nil)
+	featured := filterField("featured", models.FieldTypeBoolean, nil)
+
+	noon := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		field      models.FieldDefinition
+		op         string
+		raw        string
+		wantClause string
+		wantArgs   []interface{}
+	}{
+		// Text and other containment types
+		{"text eq", title, FilterEq, "Hello", "(data @> CAST(? AS jsonb))", []interface{}{`{"title":"Hello"}`}},
+		{"text ne", title, FilterNe, "Hello", "NOT (data @> CAST(? AS jsonb))", []interface{}{`{"title":"Hello"}`}},
+		{"text in", title, FilterIn, "a, b", "(data @> CAST(? AS jsonb) OR data @> CAST(? AS jsonb))", []interface{}{`{"title":"a"}`, `{"title":"b"}`}},
+		{"text contains", title, FilterContains, "50%_off", "data ->> CAST(? AS text) ILIKE ?", []interface{}{"title", `%50\%\_off%`}},
+		{"select eq", status, FilterEq, "live", "(data @> CAST(? AS jsonb))", []interface{}{`{"status":"live"}`}},
+		{"to-one relation eq", author, FilterEq, "jane", "(data @> CAST(? AS jsonb))", []interface{}{`{"author":"jane"}`}},
+		{"to-many relation eq", tags, FilterEq, "go", "(data @> CAST(? AS jsonb))", []interface{}{`{"tags":["go"]}`}},
+		{"to-many relation in", tags, FilterIn, "go,sql", "(data @> CAST(? AS jsonb) OR data @> CAST(? AS jsonb))", []interface{}{`{"tags":["go"]}`, `{"tags":["sql"]}`}},
+		{"media list contains", gallery, FilterContains, "m1", "data -> CAST(? AS text) @> CAST(? AS jsonb)", []interface{}{"gallery", `["m1"]`}},
+		{"boolean eq", featured, FilterEq, "true", "(data @> CAST(? AS jsonb))", []interface{}{`{"featured":true}`}},
+		{"boolean ne", featured, FilterNe, "false", "NOT (data @> CAST(? AS jsonb))", []interface{}{`{"featured":false}`}},
+
+		// Exists, a JSON null counts as missing
+		{"exists true", title, FilterExists, "true", "COALESCE(jsonb_typeof(data -> CAST(? AS text)), 'null') <> 'null'", []interface{}{"title"}},
+		{"exists false", price, FilterExists, "0", "COALESCE(jsonb_typeof(data -> CAST(? AS text)), 'null') = 'null'", []interface{}{"price"}},
+
+		// Numbers, dates and datetimes are compared as values
+		{"number eq", price, FilterEq, "9.5", numberExpr + " = ?", []interface{}{"price", "price", 9.5}},
+		{"number ne", price, FilterNe, "9.5", "(" + numberExpr + " = ?) IS NOT TRUE", []interface{}{"price", "price", 9.5}},
+		{"number lt", price, FilterLt, "10", numberExpr + " < ?", []interface{}{"price", "price", 10.0}},
+		{"number gt", price, FilterGt, "-1", numberExpr + " > ?", []interface{}{"price", "price", -1.0}},
+		{"number in", price, FilterIn, "1, 2,3", numberExpr + " IN ?", []interface{}{"price", "price", []interface{}{1.0, 2.0, 3.0}}},
+		{"number between", price, FilterBetween, "1,5", numberExpr + " BETWEEN ? AND ?", []interface{}{"price", "price", 1.0, 5.0}},
+		{"date between", day, FilterBetween, "2024-01-01,2024-12-31", dateExpr + " BETWEEN ? AND ?", []interface{}{"day", "day", "2024-01-01", "2024-12-31"}},
+		{"date ne", day, FilterNe, "2024-01-01", "(" + dateExpr + " = ?) IS NOT TRUE", []interface{}{"day", "day", "2024-01-01"}},
+		{"datetime gt", at, FilterGt, "2024-01-02T12:00:00Z", datetimeExpr + " > ?", []interface{}{"at", "at", noon}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clause, args, err := filterClause(tt.field, tt.op, tt.raw)
+			if err != nil {
+				t.Fatalf("filterClause: %v", err)
+			}
+			if clause != tt.wantClause {
+				t.Errorf("got clause\n  %s\nwant\n  %s", clause, tt.wantClause)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// TestFilterNeMatchesMissingFields checks that ne keeps the entries without
+// the field: a failed containment is negated, and a NULL comparison is not true
+func TestFilterNeMatchesMissingFields(t *testing.T) {
+	for _, field := range []models.FieldDefinition{
+		filterField("title", models.FieldTypeText, nil),
+		filterField("price", models.FieldTypeNumber, nil),
+		filterField("day", models.FieldTypeDate, nil),
+		filterField("at", models.FieldTypeDateTime, nil),
+	} {
+		raw := map[models.FieldType]string{
+			models.FieldTypeText:     "a",
+			models.FieldTypeNumber:   "1",
+			models.FieldTypeDate:     "2024-01-01",
+			models.FieldTypeDateTime: "2024-01-01T00:00:00Z",
+		}[field.Type]
+
+		clause, _, err := filterClause(field, FilterNe, raw)
+		if err != nil {
+			t.Fatalf("%s: %v", field.Type, err)
+		}
+		if !strings.HasPrefix(clause, "NOT (") && !strings.HasSuffix(clause, " IS NOT TRUE") {
+			t.Errorf("%s: clause %s would drop entries without the field", field.Type, clause)
+		}
+	}
+}
+
+func TestFilterClauseErrors(t *testing.T) {
+	manyValues := strings.TrimSuffix(strings.Repeat("x,", maxFilterValues+1), ",")
+
+	tests := []struct {
+		name    string
+		field   models.FieldDefinition
+		op      string
+		raw     string
+		wantErr string
+	}{
+		{"password field", filterField("secret", models.FieldTypePassword, nil), FilterEq, "x", "cannot be filtered"},
+		{"unknown operator", filterField("title", models.FieldTypeText, nil), "like", "x", "operator 'like' is not supported"},
+		{"lt on text", filterField("title", models.FieldTypeText, nil), FilterLt, "x", "operator 'lt' is not supported"},
+		{"contains on number", filterField("price", models.FieldTypeNumber, nil), FilterContains, "1", "operator 'contains' is not supported"},
+		{"between on boolean", filterField("featured", models.FieldTypeBoolean, nil), FilterBetween, "true,false", "operator 'between' is not supported"},
+		{"eq on media list", filterField("gallery", models.FieldTypeMediaList, nil), FilterEq, "m1", "operator 'eq' is not supported"},
+		{"between with one value", filterField("price", models.FieldTypeNumber, nil), FilterBetween, "1", "needs two comma separated values"},
+		{"between with three values", filterField("price", models.FieldTypeNumber, nil), FilterBetween, "1,2,3", "needs two comma separated values"},
+		{"in with too many values", filterField("title", models.FieldTypeText, nil), FilterIn, manyValues, "allows at most"},
+		{"exists not a boolean", filterField("title", models.FieldTypeText, nil), FilterExists, "maybe", "must be true or false"},
+		{"contains without value", filterField("title", models.FieldTypeText, nil), FilterContains, "", "needs a value"},
+		{"number not a number", filterField("price", models.FieldTypeNumber, nil), FilterEq, "cheap", "must be a number"},
+		{"in with a bad number", filterField("price", models.FieldTypeNumber, nil), FilterIn, "1,two", "must be a number"},
+		{"boolean not a boolean", filterField("featured", models.FieldTypeBoolean, nil), FilterEq, "yes", "must be true or false"},
+		{"date in another format", filterField("day", models.FieldTypeDate, nil), FilterEq, "01/02/2024", "YYYY-MM-DD"},
+		{"datetime without offset", filterField("at", models.FieldTypeDateTime, nil), FilterGt, "2024-01-02 12:00", "ISO 8601"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := filterClause(tt.field, tt.op, tt.raw)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFilterClauseInArity(t *testing.T) {
+	field := filterField("price", models.FieldTypeNumber, nil)
+	for _, n := range []int{1, 2, maxFilterValues} {
+		raw := strings.TrimSuffix(strings.Repeat("1,", n), ",")
+		_, args, err := filterClause(field, FilterIn, raw)
+		if err != nil {
+			t.Fatalf("%d values: %v", n, err)
+		}
+		if values := args[2].([]interface{}); len(values) != n {
+			t.Errorf("%d values: got %d bound values", n, len(values))
+		}
+	}
+}
+
+func TestApplyContentFiltersUnknownField(t *testing.T) {
+	fields := []models.FieldDefinition{filterField("title", models.FieldTypeText, nil)}
+	_, err := applyContentFilters(nil, []ContentFilter{{Field: "missing", Op: FilterEq, Value: "x"}}, fields)
+	if err == nil || !strings.Contains(err.Error(), "unknown filter field 'missing'") {
+		t.Errorf("got error %v, want unknown filter field", err)
+	}
+}
@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"contentive/internal/config"
+	"contentive/internal/database"
+	"contentive/internal/llm"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxGenerateAttempts is the number of times the LLM is asked for a valid value
+const maxGenerateAttempts = 3
+
+// generatableFieldTypes are the field types values can be generated for
+var generatableFieldTypes = map[models.FieldType]bool{
+	models.FieldTypeText:     true,
+	models.FieldTypeTextarea: true,
+	models.FieldTypeRichText: true,
+	models.FieldTypeSelect:   true,
+}
+
+var (
+	codeFenceRegex = regexp.MustCompile("(?s)^```[a-zA-Z]*\\n?(.*?)\\n?```$")
+	newlineRegex   = regexp.MustCompile(`\s*\n\s*`)
+)
+
+// GenerateFieldRequest is the request to generate the value of one field
+type GenerateFieldRequest struct {
+	Field        string                 `json:"field"`
+	Data         map[string]interface{} `json:"data"`                   // the partial entry, used as context
+	Instructions string                 `json:"instructions,omitempty"` // extra guidance from the editor
+	Model        string                 `json:"model,omitempty"`
+}
+
+// GenerateField generates a value for a field of a content entry with the LLM.
+// The value is validated like content data before it is returned.
+func GenerateField(c *fiber.Ctx) error {
+	schemaID := c.Params("schema_id")
+
+	var req GenerateFieldRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse generate field request: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var schema models.Schema
+	if err := database.DB.Where("id = ?", schemaID).First(&schema).Error; err != nil {
+		logger.Error("Schema not found: %v", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Schema not found",
+		})
+	}
+
+	var fields []models.FieldDefinition
+	if err := json.Unmarshal(schema.Fields, &fields); err != nil {
+		logger.Error("Error unmarshalling schema fields: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var field *models.FieldDefinition
+	for i := range fields {
+		if fields[i].Name == req.Field {
+			field = &fields[i]
+			break
+		}
+	}
+	if field == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Field '%s' does not exist in schema", req.Field),
+		})
+	}
+	if !generatableFieldTypes[field.Type] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Values cannot be generated for %s fields", field.Type),
+		})
+	}
+
+	provider := llm.GetProvider()
+	if provider == nil {
+		logger.Error("LLM provider not initialized")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "LLM service not available",
+		})
+	}
+
+	ctx, cancel := llmContext(config.AppConfig.LLM_GENERATE_TIMEOUT)
+	defer cancel()
+
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: "You write the value of a single field of a CMS content entry. Reply with the value only, without quotes, labels or explanations."},
+		{Role: llm.RoleUser, Content: buildGeneratePrompt(schema, fields, *field, req)},
+	}
+
+	var value string
+	var validationErr error
+	attempts := 0
+	for attempts < maxGenerateAttempts {
+		attempts++
+
+		resp, err := provider.Chat(ctx, llm.LLMRequest{Messages: messages, Model: req.Model})
+		if err != nil {
+			logger.Error("LLM generate field error: %v", err)
+			if errors.Is(err, llm.ErrUnavailable) {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"error": "LLM service temporarily unavailable",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get response from LLM",
+			})
+		}
+
+		value = normalizeGeneratedValue(*field, resp.Text, attempts == maxGenerateAttempts)
+		if value == "" {
+			validationErr = fmt.Errorf("field '%s' is empty", field.Name)
+		} else {
+			validationErr = validateContentData(map[string]interface{}{field.Name: value}, []models.FieldDefinition{*field})
+		}
+		if validationErr == nil {
+			break
+		}
+
+		// Tell the model what was wrong and ask again
+		messages = append(messages,
+			llm.Message{Role: llm.RoleAssistant, Content: resp.Text},
+			llm.Message{Role: llm.RoleUser, Content: fmt.Sprintf("That value is invalid: %v. Reply with a corrected value only.", validationErr)},
+		)
+	}
+
+	if validationErr != nil {
+		logger.Error("Generated value for field %s is invalid: %v", field.Name, validationErr)
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to generate a valid value: %v", validationErr),
+		})
+	}
+
+	currentUser := c.Locals("user").(models.AdminUser)
+	logger.AdminAction(
+		currentUser.ID,
+		currentUser.Name,
+		"GENERATE_FIELD",
+		fmt.Sprintf("Generated field %s of schema %s", field.Name, schema.Name),
+	)
+
+	return c.JSON(fiber.Map{
+		"field":    field.Name,
+		"value":    value,
+		"attempts": attempts,
+	})
+}
+
+// buildGeneratePrompt describes the field, its constraints and the rest of the entry
+func buildGeneratePrompt(schema models.Schema, fields []models.FieldDefinition, field models.FieldDefinition, req GenerateFieldRequest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Content type: %s\n", schema.Name)
+	fmt.Fprintf(&b, "Field: %s\n", field.Name)
+
+	switch field.Type {
+	case models.FieldTypeText:
+		b.WriteString("Format: a single line of plain text\n")
+	case models.FieldTypeTextarea:
+		b.WriteString("Format: plain text, paragraphs separated by blank lines\n")
+	case models.FieldTypeRichText:
+		b.WriteString("Format: HTML using only <p>, <h2>, <h3>, <ul>, <ol>, <li>, <strong>, <em> and <a> tags\n")
+	case models.FieldTypeSelect:
+		fmt.Fprintf(&b, "Format: exactly one of the following choices: %s\n", strings.Join(selectChoices(field), ", "))
+	}
+	if maxLength, ok := field.Options["maxLength"].(float64); ok {
+		fmt.Fprintf(&b, "Maximum length: %d characters\n", int(maxLength))
+	}
+	if minLength, ok := field.Options["minLength"].(float64); ok {
+		fmt.Fprintf(&b, "Minimum length: %d characters\n", int(minLength))
+	}
+
+	// Give the other filled in fields as context, never passwords
+	others := make(map[string]interface{})
+	for _, f := range fields {
+		if f.Name == field.Name || f.Type == models.FieldTypePassword {
+			continue
+		}
+		if value, exists := req.Data[f.Name]; exists && value != nil && value != "" {
+			others[f.Name] = value
+		}
+	}
+	if len(others) > 0 {
+		data, _ := json.MarshalIndent(others, "", "  ")
+		fmt.Fprintf(&b, "\nOther fields of the entry:\n%s\n", data)
+	}
+
+	if req.Instructions != "" {
+		fmt.Fprintf(&b, "\nInstructions: %s\n", req.Instructions)
+	}
+	return b.String()
+}
+
+// selectChoices returns the allowed values of a select field
+func selectChoices(field models.FieldDefinition) []string {
+	list, _ := field.Options["choices"].([]interface{})
+	choices := make([]string, 0, len(list))
+	for _, choice := range list {
+		if s, ok := choice.(string); ok {
+			choices = append(choices, s)
+		}
+	}
+	return choices
+}
+
+// normalizeGeneratedValue cleans up the raw LLM output so it fits the field.
+// Text is truncated to maxLength; rich text is only truncated on the last
+// attempt, since cutting it may break the markup.
+func normalizeGeneratedValue(field models.FieldDefinition, text string, lastAttempt bool) string {
+	value := strings.TrimSpace(text)
+	if m := codeFenceRegex.FindStringSubmatch(value); m != nil {
+		value = strings.TrimSpace(m[1])
+	}
+	if len(value) >= 2 && (value[0] == '"' && value[len(value)-1] == '"' || value[0] == '\'' && value[len(value)-1] == '\'') {
+		value = strings.TrimSpace(value[1 : len(value)-1])
+	}
+
+	switch field.Type {
+	case models.FieldTypeText:
+		value = newlineRegex.ReplaceAllString(value, " ")
+	case models.FieldTypeSelect:
+		// Accept a choice that only differs in case
+		for _, choice := range selectChoices(field) {
+			if strings.EqualFold(choice, value) {
+				return choice
+			}
+		}
+		return value
+	case models.FieldTypeRichText:
+		if !lastAttempt {
+			return value
+		}
+	}
+
+	if maxLength, ok := field.Options["maxLength"].(float64); ok {
+		value = truncateBytes(value, int(maxLength))
+	}
+	return value
+}
+
+// truncateBytes cuts s to at most n bytes, at a word boundary when possible,
+// without splitting a UTF-8 character
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	if i := strings.LastIndexAny(s[:cut], " \n\t"); i > cut/2 {
+		cut = i
+	}
+	return strings.TrimSpace(s[:cut])
+}
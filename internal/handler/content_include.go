@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"bytes"
+	"contentive/internal/database"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	maxIncludeDepth = 3
+	maxIncludePaths = 10
+)
+
+// includeNode is a field to populate, with the fields to populate in the
+// related entries
+type includeNode map[string]includeNode
+
+// includeError is an include that cannot be served, with the status to report
+type includeError struct {
+	status  int
+	message string
+}
+
+func (e *includeError) Error() string {
+	return e.message
+}
+
+// parseInclude reads the include parameter, a comma separated list of field
+// paths such as "author,category.parent"
+func parseInclude(include string) (includeNode, error) {
+	tree := includeNode{}
+	if strings.TrimSpace(include) == "" {
+		return tree, nil
+	}
+
+	paths := strings.Split(include, ",")
+	if len(paths) > maxIncludePaths {
+		return nil, fmt.Errorf("at most %d include paths are allowed", maxIncludePaths)
+	}
+	for _, path := range paths {
+		names := strings.Split(strings.TrimSpace(path), ".")
+		if len(names) > maxIncludeDepth {
+			return nil, fmt.Errorf("include '%s' is deeper than %d levels", path, maxIncludeDepth)
+		}
+		node := tree
+		for _, name := range names {
+			if name == "" {
+				return nil, fmt.Errorf("invalid include '%s'", path)
+			}
+			if node[name] == nil {
+				node[name] = includeNode{}
+			}
+			node = node[name]
+		}
+	}
+	return tree, nil
+}
+
+// includeAccess is what the caller may include. API users need the read
+// scope of a schema and only see its published entries.
+type includeAccess struct {
+	apiUser *models.APIUser
+}
+
+func (a includeAccess) canRead(scope string) bool {
+	return a.apiUser == nil || a.apiUser.HasScope(scope)
+}
+
+// populatedEntry is an entry whose data is being populated
+type populatedEntry struct {
+	entry *models.ContentEntry
+	data  map[string]interface{}
+}
+
+// populateContent replaces the relation and media fields named in the include
+// tree with the related entries and media. Lookups are batched per field and
+// level. Related entries that are missing or not visible become null.
+func populateContent(c *fiber.Ctx, schema models.Schema, entries []models.ContentEntry, tree includeNode) error {
+	if len(tree) == 0 || len(entries) == 0 {
+		return nil
+	}
+
+	level := make([]populatedEntry, len(entries))
+	for i := range entries {
+		level[i].entry = &entries[i]
+	}
+
+	var access includeAccess
+	if apiUser, ok := c.Locals("user").(models.APIUser); ok {
+		access.apiUser = &apiUser
+	}
+
+	return populateLevel(schema, level, tree, access)
+}
+
+func populateLevel(schema models.Schema, level []populatedEntry, tree includeNode, access includeAccess) error {
+	var fields []models.FieldDefinition
+	if err := json.Unmarshal(schema.Fields, &fields); err != nil {
+		return err
+	}
+	fieldsByName := make(map[string]models.FieldDefinition, len(fields))
+	for _, field := range fields {
+		fieldsByName[field.Name] = field
+	}
+
+	for i := range level {
+		// Numbers are kept as they are, not rounded to float64
+		decoder := json.NewDecoder(bytes.NewReader(level[i].entry.Data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&level[i].data); err != nil && err != io.EOF {
+			return err
+		}
+		if level[i].data == nil {
+			level[i].data = map[string]interface{}{}
+		}
+	}
+
+	for name, children := range tree {
+		field, exists := fieldsByName[name]
+		if !exists {
+			return &includeError{fiber.StatusBadRequest, fmt.Sprintf("cannot include '%s', it is not a field of %s", name, schema.Slug)}
+		}
+
+		var err error
+		switch field.Type {
+		case models.FieldTypeRelation:
+			err = populateRelation(field, level, children, access)
+		case models.FieldTypeMedia, models.FieldTypeMediaList:
+			if len(children) > 0 {
+				return &includeError{fiber.StatusBadRequest, fmt.Sprintf("cannot include fields of media field '%s'", name)}
+			}
+			err = populateMedia(field, level, access)
+		default:
+			return &includeError{fiber.StatusBadRequest, fmt.Sprintf("cannot include %s field '%s', only relation and media fields", field.Type, name)}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range level {
+		data, err := json.Marshal(p.data)
+		if err != nil {
+			return err
+		}
+		p.entry.Data = data
+	}
+	return nil
+}
+
+// includedValues returns the slugs or IDs stored in a field, which holds one
+// or a list of them
+func includedValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// replaceIncluded replaces the slugs or IDs of a field with what they resolve
+// to, or null when they do not resolve
+func replaceIncluded(data map[string]interface{}, name string, resolve func(string) interface{}) {
+	switch v := data[name].(type) {
+	case string:
+		data[name] = resolve(v)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			if s, ok := item.(string); ok {
+				items[i] = resolve(s)
+			}
+		}
+		data[name] = items
+	}
+}
+
+func populateRelation(field models.FieldDefinition, level []populatedEntry, children includeNode, access includeAccess) error {
+	targetSlug, _ := field.Options["targetSchema"].(string)
+	var target models.Schema
+	if err := database.DB.Where("slug = ?", targetSlug).First(&target).Error; err != nil {
+		logger.Error("Target schema %s of field %s not found: %v", targetSlug, field.Name, err)
+		return &includeError{fiber.StatusBadRequest, fmt.Sprintf("the target schema of field '%s' does not exist", field.Name)}
+	}
+	if !access.canRead(target.Slug + ":read") {
+		return &includeError{fiber.StatusForbidden, fmt.Sprintf("insufficient permissions to include '%s', %s:read is required", field.Name, target.Slug)}
+	}
+
+	seen := make(map[string]bool)
+	var slugs []string
+	for _, p := range level {
+		for _, slug := range includedValues(p.data[field.Name]) {
+			if !seen[slug] {
+				seen[slug] = true
+				slugs = append(slugs, slug)
+			}
+		}
+	}
+	if len(slugs) == 0 {
+		return nil
+	}
+
+	db := database.DB.Where("content_type_id = ? AND slug IN ?", target.ID, slugs)
+	if access.apiUser != nil {
+		db = db.Where("is_published = ?", true)
+	}
+	var related []models.ContentEntry
+	if err := db.Find(&related).Error; err != nil {
+		return err
+	}
+
+	if len(children) > 0 && len(related) > 0 {
+		next := make([]populatedEntry, len(related))
+		for i := range related {
+			next[i].entry = &related[i]
+		}
+		if err := populateLevel(target, next, children, access); err != nil {
+			return err
+		}
+	}
+
+	bySlug := make(map[string]*models.ContentEntry, len(related))
+	for i := range related {
+		bySlug[related[i].Slug] = &related[i]
+	}
+	for _, p := range level {
+		replaceIncluded(p.data, field.Name, func(slug string) interface{} {
+			if entry, ok := bySlug[slug]; ok {
+				return entry
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+func populateMedia(field models.FieldDefinition, level []populatedEntry, access includeAccess) error {
+	if !access.canRead("media:read") {
+		return &includeError{fiber.StatusForbidden, fmt.Sprintf("insufficient permissions to include '%s', media:read is required", field.Name)}
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	var ids []uuid.UUID
+	for _, p := range level {
+		for _, value := range includedValues(p.data[field.Name]) {
+			id, err := uuid.Parse(value)
+			if err == nil && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var media []models.Media
+	if err := database.DB.Where("id IN ?", ids).Find(&media).Error; err != nil {
+		return err
+	}
+
+	byID := make(map[string]*models.Media, len(media))
+	for i := range media {
+		byID[media[i].ID.String()] = &media[i]
+	}
+	for _, p := range level {
+		replaceIncluded(p.data, field.Name, func(value string) interface{} {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				return nil
+			}
+			if m, ok := byID[id.String()]; ok {
+				return m
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+// includeErrorResponse reports a failed population
+func includeErrorResponse(c *fiber.Ctx, err error) error {
+	if ie, ok := err.(*includeError); ok {
+		return c.Status(ie.status).JSON(fiber.Map{
+			"error": ie.message,
+		})
+	}
+	logger.Error("Failed to include related content: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to include related content",
+	})
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"contentive/internal/database"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"contentive/internal/rag"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// syncContentRelations updates the links of an entry after its data changed
+func syncContentRelations(tx *gorm.DB, entry models.ContentEntry) error {
+	var schema models.Schema
+	if err := tx.Where("id = ?", entry.ContentTypeID).First(&schema).Error; err != nil {
+		return err
+	}
+	var fields []models.FieldDefinition
+	if err := json.Unmarshal(schema.Fields, &fields); err != nil {
+		return err
+	}
+	return models.SyncRelations(tx, entry, fields)
+}
+
+// relationErrorResponse reports links that could not be saved. A link that
+// breaks the cardinality of its field is a conflict.
+func relationErrorResponse(c *fiber.Ctx, err error) error {
+	var conflict *models.RelationConflictError
+	if errors.As(err, &conflict) {
+		logger.Warning("Relation conflict: %v", err)
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": conflict.Error(),
+		})
+	}
+	logger.Error("Failed to save relations: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to save relations",
+	})
+}
+
+// deletePlanSummary describes the cascades and cleared references of a delete
+// for the action log
+func deletePlanSummary(plan *models.DeletePlan) string {
+	if len(plan.Cascade) == 0 && len(plan.SetNull) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d entries deleted by cascade, %d references cleared)", len(plan.Cascade), len(plan.SetNull))
+}
+
+// missingDeleteScopes returns the scopes an API user lacks for the cascades
+// and cleared references of a delete. Admin users may do all of them.
+func missingDeleteScopes(user interface{}, plan *models.DeletePlan) []string {
+	apiUser, ok := user.(models.APIUser)
+	if !ok {
+		return nil
+	}
+	var missing []string
+	for _, scope := range plan.Scopes() {
+		if !apiUser.HasScope(scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// enqueueDeletePlan refreshes the knowledge index of the entries a delete
+// removed or changed
+func enqueueDeletePlan(plan *models.DeletePlan) {
+	for _, id := range append(plan.Entries, plan.Cascade...) {
+		rag.Enqueue(id)
+	}
+	for _, reference := range plan.SetNull {
+		rag.Enqueue(reference.EntryID)
+	}
+}
+
+// GetContentReferences lists the entries that refer to a content entry through
+// their relation fields
+func GetContentReferences(c *fiber.Ctx) error {
+	schemaID := c.Params("schema_id")
+	contentID := c.Params("content_id")
+
+	var content models.ContentEntry
+	if err := database.DB.Where("id = ? AND content_type_id = ?", contentID, schemaID).First(&content).Error; err != nil {
+		logger.Error("Content not found: %v", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Content not found",
+		})
+	}
+
+	references, err := models.ContentUsages(database.DB, []uuid.UUID{content.ID})
+	if err != nil {
+		logger.Error("Failed to find references to content: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find references",
+		})
+	}
+	if references == nil {
+		references = []models.Reference{}
+	}
+
+	return c.JSON(fiber.Map{
+		"content_id": content.ID,
+		"slug":       content.Slug,
+		"references": references,
+		"total":      len(references),
+	})
+}
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"contentive/internal/database"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ScheduleContentRequest sets when a content entry is published or unpublished
+type ScheduleContentRequest struct {
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
+}
+
+// ScheduleQuery represents the query parameters for the ListSchedules handler
+type ScheduleQuery struct {
+	Page     int    `query:"page"`
+	PageSize int    `query:"page_size"`
+	SchemaID string `query:"schema_id"`
+}
+
+// ContentSchedule is a pending schedule of a content entry
+type ContentSchedule struct {
+	ContentID   uuid.UUID  `json:"content_id"`
+	Slug        string     `json:"slug"`
+	SchemaID    uuid.UUID  `json:"schema_id"`
+	SchemaSlug  string     `json:"schema_slug"`
+	IsPublished bool       `json:"is_published"`
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
+	ScheduledBy *uuid.UUID `json:"scheduled_by"`
+}
+
+// ScheduleContent schedules a content entry to be published or unpublished
+// later. The scheduler applies the schedule once it is due.
+func ScheduleContent(c *fiber.Ctx) error {
+	schemaID := c.Params("schema_id")
+	contentID := c.Params("content_id")
+	currentUser := c.Locals("user").(models.AdminUser)
+
+	var content models.ContentEntry
+	if err := database.DB.Where("id = ? AND content_type_id = ?", contentID, schemaID).First(&content).Error; err != nil {
+		logger.Error("Content not found: %v", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Content not found",
+		})
+	}
+
+	var input ScheduleContentRequest
+	if err := c.BodyParser(&input); err != nil {
+		logger.Error("Error parsing request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if input.PublishAt == nil && input.UnpublishAt == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "publish_at or unpublish_at is required",
+		})
+	}
+
+	now := time.Now()
+	if input.PublishAt != nil {
+		if !input.PublishAt.After(now) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "publish_at must be in the future, publish the content to publish it now",
+			})
+		}
+		content.PublishAt = input.PublishAt
+	}
+	if input.UnpublishAt != nil {
+		if !input.UnpublishAt.After(now) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "unpublish_at must be in the future, unpublish the content to unpublish it now",
+			})
+		}
+		content.UnpublishAt = input.UnpublishAt
+	}
+	if content.PublishAt != nil && content.UnpublishAt != nil && !content.UnpublishAt.After(*content.PublishAt) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "unpublish_at must be after publish_at",
+		})
+	}
+	content.ScheduledBy = &currentUser.ID
+
+	if err := database.DB.Model(&content).Select("publish_at", "unpublish_at", "scheduled_by").Updates(&content).Error; err != nil {
+		logger.Error("Failed to schedule content: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to schedule content",
+		})
+	}
+
+	logger.AdminAction(
+		currentUser.ID,
+		currentUser.Name,
+		"SCHEDULE_CONTENT",
+		fmt.Sprintf("Scheduled content %s, publish at: %s, unpublish at: %s", content.Slug, formatSchedule(content.PublishAt), formatSchedule(content.UnpublishAt)),
+	)
+
+	return c.Status(fiber.StatusOK).JSON(content)
+}
+
+// CancelContentSchedule cancels the pending schedules of a content entry. The
+// type query parameter limits it to "publish" or "unpublish".
+func CancelContentSchedule(c *fiber.Ctx) error {
+	schemaID := c.Params("schema_id")
+	contentID := c.Params("content_id")
+	currentUser := c.Locals("user").(models.AdminUser)
+
+	var content models.ContentEntry
+	if err := database.DB.Where("id = ? AND content_type_id = ?", contentID, schemaID).First(&content).Error; err != nil {
+		logger.Error("Content not found: %v", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Content not found",
+		})
+	}
+
+	scheduleType := c.Query("type")
+	switch scheduleType {
+	case "":
+		content.PublishAt = nil
+		content.UnpublishAt = nil
+	case "publish":
+		content.PublishAt = nil
+	case "unpublish":
+		content.UnpublishAt = nil
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "type must be publish or unpublish",
+		})
+	}
+	if content.PublishAt == nil && content.UnpublishAt == nil {
+		content.ScheduledBy = nil
+	}
+
+	// Only cancel what is still pending, the scheduler may have applied it
+	db := database.DB.Model(&content).Select("publish_at", "unpublish_at", "scheduled_by")
+	switch scheduleType {
+	case "publish":
+		db = db.Where("publish_at IS NOT NULL")
+	case "unpublish":
+		db = db.Where("unpublish_at IS NOT NULL")
+	default:
+		db = db.Where("publish_at IS NOT NULL OR unpublish_at IS NOT NULL")
+	}
+	result := db.Updates(&content)
+	if result.Error != nil {
+		logger.Error("Failed to cancel content schedule: %v", result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to cancel schedule",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No pending schedule",
+		})
+	}
+
+	logger.AdminAction(
+		currentUser.ID,
+		currentUser.Name,
+		"CANCEL_CONTENT_SCHEDULE",
+		"Cancelled schedule of content "+content.Slug,
+	)
+
+	return c.Status(fiber.StatusOK).JSON(content)
+}
+
+// ListSchedules lists the pending schedules, the next one first
+func ListSchedules(c *fiber.Ctx) error {
+	query := new(ScheduleQuery)
+	if err := c.QueryParser(query); err != nil {
+		logger.Error("Error parsing query parameters: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid query parameters",
+		})
+	}
+
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.PageSize <= 0 {
+		query.PageSize = 20
+	} else if query.PageSize > 100 {
+		query.PageSize = 100
+	}
+
+	db := database.DB.Table("content_entries ce").
+		Joins("JOIN schemas s ON s.id = ce.content_type_id").
+		Where("ce.publish_at IS NOT NULL OR ce.unpublish_at IS NOT NULL")
+	if query.SchemaID != "" {
+		schemaID, err := uuid.Parse(query.SchemaID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid schema_id",
+			})
+		}
+		db = db.Where("ce.content_type_id = ?", schemaID)
+	}
+
+	var total int64
+	if err := db.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		logger.Error("Error counting schedules: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count schedules",
+		})
+	}
+
+	var schedules []ContentSchedule
+	if err := db.Select("ce.id AS content_id, ce.slug, s.id AS schema_id, s.slug AS schema_slug, ce.is_published, ce.publish_at, ce.unpublish_at, ce.scheduled_by").
+		Order("LEAST(ce.publish_at, ce.unpublish_at), ce.id").
+		Offset((query.Page - 1) * query.PageSize).
+		Limit(query.PageSize).
+		Scan(&schedules).Error; err != nil {
+		logger.Error("Failed to get schedules: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get schedules",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": schedules,
+		"pagination": fiber.Map{
+			"current_page": query.Page,
+			"page_size":    query.PageSize,
+			"total_pages":  (total + int64(query.PageSize) - 1) / int64(query.PageSize),
+			"total":        total,
+		},
+	})
+}
+
+// formatSchedule formats a schedule time for the action log
+func formatSchedule(t *time.Time) string {
+	if t == nil {
+		return "none"
+	}
+	return t.Format(time.RFC3339)
+}
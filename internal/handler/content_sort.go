@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"contentive/internal/models"
+	"fmt"
+	"strings"
+)
+
+const maxContentSortKeys = 5
+
+// contentSortColumns are the columns of an entry content can be sorted by,
+// with their SQL types. Schema fields with the same name are sorted by as
+// data.<name>.
+var contentSortColumns = map[string]string{
+	"created_at":   "timestamptz",
+	"updated_at":   "timestamptz",
+	"published_at": "timestamptz",
+	"slug":         "text",
+}
+
+// contentSortKeys returns the sort keys of a content list. orderBy is a comma
+// separated list of columns and schema fields, a key prefixed with "-" sorts
+// descending. Keys without a prefix sort in the given order; without one, a
+// single key sorts descending as it always did and the keys of a list sort
+// ascending. The id is the last key, so that the order is total and pages do
+// not overlap.
+func contentSortKeys(orderBy string, order string, fields []models.FieldDefinition) ([]sortKey, error) {
+	keys := strings.Split(orderBy, ",")
+	if len(keys) > maxContentSortKeys {
+		return nil, fmt.Errorf("at most %d order_by keys are allowed", maxContentSortKeys)
+	}
+
+	defaultDesc := len(keys) == 1
+	switch strings.ToLower(order) {
+	case "asc":
+		defaultDesc = false
+	case "desc":
+		defaultDesc = true
+	}
+
+	fieldsByName := make(map[string]models.FieldDefinition, len(fields))
+	for _, field := range fields {
+		fieldsByName[field.Name] = field
+	}
+
+	sortKeys := make([]sortKey, 0, len(keys)+1)
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		desc := defaultDesc
+		if name, prefixed := strings.CutPrefix(key, "-"); prefixed {
+			key = name
+			desc = true
+		}
+
+		name, isField := strings.CutPrefix(key, "data.")
+		if columnType, isColumn := contentSortColumns[key]; !isField && isColumn {
+			sortKeys = append(sortKeys, sortKey{Expression: key, Type: columnType, Desc: desc})
+			continue
+		}
+
+		field, exists := fieldsByName[name]
+		if !exists {
+			return nil, fmt.Errorf("cannot sort by '%s', it is not a field of the schema", key)
+		}
+		expression, err := field.SortExpression()
+		if err != nil {
+			return nil, err
+		}
+		sortKeys = append(sortKeys, sortKey{Expression: expression, Type: field.SortType(), Desc: desc})
+	}
+
+	return append(sortKeys, sortKey{Expression: "id", Type: "uuid"}), nil
+}
@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"contentive/internal/config"
+	"contentive/internal/database"
+	"contentive/internal/llm"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
+)
+
+// maxTranslateAttempts allows one retry when the translation is invalid
+const maxTranslateAttempts = 2
+
+// translatableFieldTypes are the field types whose values are translated.
+// Everything else, including relation slugs and media IDs, is copied as is.
+var translatableFieldTypes = map[models.FieldType]bool{
+	models.FieldTypeText:     true,
+	models.FieldTypeTextarea: true,
+	models.FieldTypeRichText: true,
+}
+
+// localeRegex accepts BCP 47 style tags such as fr, pt-BR or zh-Hans-CN
+var localeRegex = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// TranslateContentRequest is the request to translate a content entry
+type TranslateContentRequest struct {
+	Locale       string `json:"locale"`            // target locale, e.g. fr-FR
+	Version      int    `json:"version,omitempty"` // version to translate, defaults to the entry's current data
+	Instructions string `json:"instructions,omitempty"`
+	Model        string `json:"model,omitempty"`
+}
+
+const translatePrompt = `You translate the fields of a CMS content entry.
+You receive a JSON object mapping field names to text and reply with a JSON object with exactly the same keys, each value translated.
+Rules:
+- keep HTML tags, attributes and URLs unchanged, only translate the text between tags
+- keep placeholders, code, product names and numbers as they are
+- keep line breaks and paragraph structure
+- do not add explanations`
+
+// TranslateContent translates the text fields of a content entry into a locale
+// with the LLM and saves the result as a new draft version. The live data of
+// the entry is not changed until the version is published.
+func TranslateContent(c *fiber.Ctx) error {
+	schemaID := c.Params("schema_id")
+	contentID := c.Params("content_id")
+
+	var req TranslateContentRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse translate request: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if !localeRegex.MatchString(req.Locale) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "locale must be a language tag such as fr or pt-BR",
+		})
+	}
+
+	var schema models.Schema
+	if err := database.DB.Where("id = ?", schemaID).First(&schema).Error; err != nil {
+		logger.Error("Schema not found: %v", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Schema not found",
+		})
+	}
+
+	var contentEntry models.ContentEntry
+	if err := database.DB.Where("id = ? AND content_type_id = ?", contentID, schemaID).First(&contentEntry).Error; err != nil {
+		logger.Error("Content not found: %v", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Content not found",
+		})
+	}
+
+	// Translate the current data, or the data of the requested version
+	source := contentEntry.Data
+	sourceLabel := "the current data"
+	if req.Version > 0 {
+		var version models.ContentVersion
+		if err := database.DB.Where("content_entry_id = ? AND version = ?", contentEntry.ID, req.Version).
+			First(&version).Error; err != nil {
+			logger.Error("Content version not found: %v", err)
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Content version not found",
+			})
+		}
+		source = version.Data
+		sourceLabel = fmt.Sprintf("version %d", version.Version)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(source, &data); err != nil {
+		logger.Error("Error unmarshalling content data: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var fields []models.FieldDefinition
+	if err := json.Unmarshal(schema.Fields, &fields); err != nil {
+		logger.Error("Error unmarshalling schema fields: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Collect the non-empty text fields
+	texts := make(map[string]string)
+	var translatedFields []models.FieldDefinition
+	for _, field := range fields {
+		if !translatableFieldTypes[field.Type] {
+			continue
+		}
+		if text, ok := data[field.Name].(string); ok && strings.TrimSpace(text) != "" {
+			texts[field.Name] = text
+			translatedFields = append(translatedFields, field)
+		}
+	}
+	if len(texts) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The entry has no text to translate",
+		})
+	}
+
+	provider := llm.GetProvider()
+	if provider == nil {
+		logger.Error("LLM provider not initialized")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "LLM service not available",
+		})
+	}
+
+	textsJSON, _ := json.MarshalIndent(texts, "", "  ")
+	prompt := fmt.Sprintf("Target locale: %s\n", req.Locale)
+	if req.Instructions != "" {
+		prompt += fmt.Sprintf("Instructions: %s\n", req.Instructions)
+	}
+	prompt += fmt.Sprintf("\nFields:\n%s", textsJSON)
+
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: translatePrompt},
+		{Role: llm.RoleUser, Content: prompt},
+	}
+
+	ctx, cancel := llmContext(config.AppConfig.LLM_TRANSLATE_TIMEOUT)
+	defer cancel()
+
+	var translated map[string]interface{}
+	var validationErr error
+	attempts := 0
+	for attempts < maxTranslateAttempts {
+		attempts++
+
+		resp, err := provider.Chat(ctx, llm.LLMRequest{
+			Messages: messages,
+			Model:    req.Model,
+			Format:   &llm.ResponseFormat{Type: llm.ResponseFormatJSONObject},
+		})
+		if err != nil {
+			logger.Error("LLM translate error: %v", err)
+			if errors.Is(err, llm.ErrUnavailable) {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"error": "LLM service temporarily unavailable",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get response from LLM",
+			})
+		}
+
+		translated, validationErr = parseTranslation(resp.Text, texts)
+		if validationErr == nil {
+			validationErr = validateContentData(translated, translatedFields)
+		}
+		if validationErr == nil {
+			break
+		}
+
+		messages = append(messages,
+			llm.Message{Role: llm.RoleAssistant, Content: resp.Text},
+			llm.Message{Role: llm.RoleUser, Content: fmt.Sprintf("That translation is invalid: %v. Reply with the corrected JSON object only.", validationErr)},
+		)
+	}
+
+	if validationErr != nil {
+		logger.Error("Translation of content %s is invalid: %v", contentEntry.ID, validationErr)
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to translate the entry: %v", validationErr),
+		})
+	}
+
+	// Only the text fields change, everything else is kept from the source
+	for name, value := range translated {
+		data[name] = value
+	}
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		logger.Error("Failed to marshal data: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process data",
+		})
+	}
+
+	names := make([]string, 0, len(texts))
+	for name := range texts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	comment := fmt.Sprintf("Translated %s into %s with the LLM (fields: %s)", sourceLabel, req.Locale, strings.Join(names, ", "))
+
+	currentUser := c.Locals("user").(models.AdminUser)
+
+	tx := database.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("Failed to start transaction: %v", tx.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var maxVersion struct {
+		MaxVersion int
+	}
+	if err := tx.Model(&models.ContentVersion{}).
+		Select("MAX(version) as max_version").
+		Where("content_entry_id = ?", contentEntry.ID).
+		Scan(&maxVersion).Error; err != nil {
+		tx.Rollback()
+		logger.Error("Failed to get max version: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	newVersion := models.ContentVersion{
+		ContentEntryID: contentEntry.ID,
+		Version:        maxVersion.MaxVersion + 1,
+		Data:           datatypes.JSON(dataJSON),
+		CreatedByID:    &currentUser.ID,
+		Comment:        comment,
+		Status:         "draft",
+	}
+	if err := tx.Create(&newVersion).Error; err != nil {
+		tx.Rollback()
+		logger.Error("Failed to create content version: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create content version",
+		})
+	}
+
+	if err := tx.Model(&contentEntry).Update("current_version", newVersion.Version).Error; err != nil {
+		tx.Rollback()
+		logger.Error("Failed to update content entry: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update content entry",
+		})
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("Failed to commit transaction: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	logger.AdminAction(
+		currentUser.ID,
+		currentUser.Name,
+		"TRANSLATE_CONTENT",
+		fmt.Sprintf("Created version %d of content %s translated into %s", newVersion.Version, contentEntry.ID, req.Locale),
+	)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  fmt.Sprintf("Created draft version %d translated into %s", newVersion.Version, req.Locale),
+		"version":  newVersion,
+		"fields":   names,
+		"attempts": attempts,
+	})
+}
+
+// parseTranslation decodes the LLM output and checks that every field came
+// back as text and that no other fields were added
+func parseTranslation(text string, texts map[string]string) (map[string]interface{}, error) {
+	text = strings.TrimSpace(text)
+	if m := codeFenceRegex.FindStringSubmatch(text); m != nil {
+		text = m[1]
+	}
+
+	var translated map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &translated); err != nil {
+		return nil, fmt.Errorf("not a valid JSON object: %v", err)
+	}
+
+	for name := range translated {
+		if _, exists := texts[name]; !exists {
+			return nil, fmt.Errorf("unexpected field '%s'", name)
+		}
+	}
+	for name := range texts {
+		value, ok := translated[name].(string)
+		if !ok || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("field '%s' is missing or not text", name)
+		}
+	}
+	return translated, nil
+}
@@ -4,6 +4,7 @@ import (
 	"contentive/internal/database"
 	"contentive/internal/logger"
 	"contentive/internal/models"
+	"contentive/internal/rag"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -134,6 +135,11 @@ func RestoreContentVersion(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := syncContentRelations(tx, contentEntry); err != nil {
+		tx.Rollback()
+		return relationErrorResponse(c, err)
+	}
+
 	// Create new version (based on restored version)
 	var userID uuid.UUID
 	var userType models.ContentEntryUserByType
@@ -199,6 +205,9 @@ func RestoreContentVersion(c *fiber.Ctx) error {
 		})
 	}
 
+	// Refresh the knowledge index in the background
+	rag.Enqueue(contentEntry.ID)
+
 	return c.JSON(fiber.Map{
 		"message": fmt.Sprintf("Content restored to version %d", version),
 		"content": contentEntry,
@@ -656,6 +665,11 @@ func PublishContentVersion(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := syncContentRelations(tx, contentEntry); err != nil {
+		tx.Rollback()
+		return relationErrorResponse(c, err)
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		logger.Error("Failed to commit transaction: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -663,6 +677,9 @@ func PublishContentVersion(c *fiber.Ctx) error {
 		})
 	}
 
+	// Refresh the knowledge index in the background
+	rag.Enqueue(contentEntry.ID)
+
 	return c.JSON(fiber.Map{
 		"message": fmt.Sprintf("Published version %d for content", version),
 		"content": contentEntry,
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// sortKey is one key of the order of a listing. The expression is trusted SQL.
+type sortKey struct {
+	Expression string
+	Type       string // SQL type the cursor value is cast back to
+	Desc       bool
+}
+
+// pageCursor is the position a keyset page starts from. It holds the sort
+// values of the row next to the page, as text, NULL values included.
+type pageCursor struct {
+	Order  string    `json:"o"` // fingerprint of the order the cursor was made for
+	Values []*string `json:"v"`
+	Before bool      `json:"b,omitempty"` // the page ends before the row instead of starting after it
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// orderFingerprint identifies an order, so a cursor is only used with the
+// order it was made for
+func orderFingerprint(keys []sortKey) string {
+	h := fnv.New64a()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s %v;", key.Expression, key.Desc)
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// orderClause returns the ORDER BY of the keys, reversed to read backwards
+func orderClause(keys []sortKey, reverse bool) string {
+	terms := make([]string, len(keys))
+	for i, key := range keys {
+		direction := "ASC"
+		if key.Desc != reverse {
+			direction = "DESC"
+		}
+		terms[i] = key.Expression + " " + direction
+	}
+	return strings.Join(terms, ", ")
+}
+
+// encodeCursor makes an opaque cursor
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor reads a cursor and checks that it belongs to the order
+func decodeCursor(s string, keys []sortKey) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || len(cursor.Values) != len(keys) {
+		return nil, errInvalidCursor
+	}
+	if cursor.Order != orderFingerprint(keys) {
+		return nil, errors.New("the cursor was made for another order, start again without it")
+	}
+	return &cursor, nil
+}
+
+// keysetClause returns the predicate of the rows after the cursor values in
+// the order of the keys, or before them. NULL sorts after every value, as it
+// does in Postgres.
+func keysetClause(keys []sortKey, values []*string, before bool) (string, []interface{}) {
+	var alternatives []string
+	var args []interface{}
+	var equal []string
+	var equalArgs []interface{}
+
+	for i, key := range keys {
+		value := values[i]
+		param := fmt.Sprintf("CAST(? AS %s)", key.Type)
+
+		// Ascending order with NULLs last means "after" is greater or NULL
+		greater := key.Desc == before
+		var past string
+		var pastArgs []interface{}
+		switch {
+		case value == nil && greater:
+			past = "" // nothing comes after NULL
+		case value == nil:
+			past = key.Expression + " IS NOT NULL"
+		case greater:
+			past = fmt.Sprintf("(%s > %s OR %s IS NULL)", key.Expression, param, key.Expression)
+			pastArgs = []interface{}{*value}
+		default:
+			past = fmt.Sprintf("%s < %s", key.Expression, param)
+			pastArgs = []interface{}{*value}
+		}
+
+		if past != "" {
+			alternatives = append(alternatives, strings.Join(append(append([]string{}, equal...), past), " AND "))
+			args = append(append(args, equalArgs...), pastArgs...)
+		}
+
+		if value == nil {
+			equal = append(equal, key.Expression+" IS NULL")
+		} else {
+			equal = append(equal, fmt.Sprintf("%s = %s", key.Expression, param))
+			equalArgs = append(equalArgs, *value)
+		}
+	}
+
+	if len(alternatives) == 0 {
+		return "FALSE", nil
+	}
+	return "((" + strings.Join(alternatives, ") OR (") + "))", args
+}
+
+// keysetPage limits the query to the page of the cursor. It fetches one row
+// more than the limit, which tells whether there is a further page.
+func keysetPage(db *gorm.DB, keys []sortKey, cursor *pageCursor, limit int) *gorm.DB {
+	before := cursor != nil && cursor.Before
+	if cursor != nil {
+		clause, args := keysetClause(keys, cursor.Values, before)
+		db = db.Where(clause, args...)
+	}
+	return db.Order(orderClause(keys, before)).Limit(limit + 1)
+}
+
+// keysetCursors returns the cursors of the pages around a fetched page, given
+// the ids of its first and last rows. A cursor is empty when there is no page
+// in that direction.
+func keysetCursors(db *gorm.DB, model interface{}, keys []sortKey, cursor *pageCursor, hasMore bool, firstID, lastID uuid.UUID) (next string, prev string, err error) {
+	selects := make([]string, len(keys))
+	for i, key := range keys {
+		selects[i] = fmt.Sprintf("CAST(%s AS text)", key.Expression)
+	}
+	values := func(id uuid.UUID) ([]*string, error) {
+		row := make([]*string, len(keys))
+		dest := make([]interface{}, len(keys))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := db.Model(model).Select(strings.Join(selects, ", ")).Where("id = ?", id).Row().Scan(dest...); err != nil {
+			return nil, err
+		}
+		return row, nil
+	}
+	return pageCursors(keys, cursor, hasMore, firstID, lastID, values)
+}
+
+// pageCursors builds the cursors of keysetCursors, reading the sort values of
+// a row with values
+func pageCursors(keys []sortKey, cursor *pageCursor, hasMore bool, firstID, lastID uuid.UUID, values func(id uuid.UUID) ([]*string, error)) (next string, prev string, err error) {
+	before := cursor != nil && cursor.Before
+	hasNext := (!before && hasMore) || (before && cursor != nil)
+	hasPrev := (before && hasMore) || (!before && cursor != nil)
+	if !hasNext && !hasPrev {
+		return "", "", nil
+	}
+
+	fingerprint := orderFingerprint(keys)
+	if hasNext {
+		v, err := values(lastID)
+		if err != nil {
+			return "", "", err
+		}
+		next = encodeCursor(pageCursor{Order: fingerprint, Values: v})
+	}
+	if hasPrev {
+		v, err := values(firstID)
+		if err != nil {
+			return "", "", err
+		}
+		prev = encodeCursor(pageCursor{Order: fingerprint, Values: v, Before: true})
+	}
+	return next, prev, nil
+}
@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func str(s string) *string { return &s }
+
+func TestKeysetClause(t *testing.T) {
+	asc := []sortKey{{Expression: "a", Type: "integer"}, {Expression: "id", Type: "uuid"}}
+	desc := []sortKey{{Expression: "a", Type: "integer", Desc: true}, {Expression: "id", Type: "uuid"}}
+
+	tests := []struct {
+		name       string
+		keys       []sortKey
+		values     []*string
+		before     bool
+		wantClause string
+		wantArgs   []interface{}
+	}{
+		{"asc after value", asc, []*string{str("5"), str("x")}, false,
+			"(((a > CAST(? AS integer) OR a IS NULL)) OR (a = CAST(? AS integer) AND (id > CAST(? AS uuid) OR id IS NULL)))",
+			[]interface{}{"5", "5", "x"}},
+		{"asc after null", asc, []*string{nil, str("x")}, false,
+			"((a IS NULL AND (id > CAST(? AS uuid) OR id IS NULL)))",
+			[]interface{}{"x"}},
+		{"asc before value", asc, []*string{str("5"), str("x")}, true,
+			"((a < CAST(? AS integer)) OR (a = CAST(? AS integer) AND id < CAST(? AS uuid)))",
+			[]interface{}{"5", "5", "x"}},
+		{"asc before null", asc, []*string{nil, str("x")}, true,
+			"((a IS NOT NULL) OR (a IS NULL AND id < CAST(? AS uuid)))",
+			[]interface{}{"x"}},
+		{"desc after value", desc, []*string{str("5"), str("x")}, false,
+			"((a < CAST(? AS integer)) OR (a = CAST(? AS integer) AND (id > CAST(? AS uuid) OR id IS NULL)))",
+			[]interface{}{"5", "5", "x"}},
+		{"desc after null", desc, []*string{nil, str("x")}, false,
+			"((a IS NOT NULL) OR (a IS NULL AND (id > CAST(? AS uuid) OR id IS NULL)))",
+			[]interface{}{"x"}},
+		{"desc before value", desc, []*string{str("5"), str("x")}, true,
+			"(((a > CAST(? AS integer) OR a IS NULL)) OR (a = CAST(? AS integer) AND id < CAST(? AS uuid)))",
+			[]interface{}{"5", "5", "x"}},
+		{"desc before null", desc, []*string{nil, str("x")}, true,
+			"((a IS NULL AND id < CAST(? AS uuid)))",
+			[]interface{}{"x"}},
+		{"nothing after null", asc[:1], []*string{nil}, false, "FALSE", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clause, args := keysetClause(tt.keys, tt.values, tt.before)
+			if clause != tt.wantClause {
+				t.Errorf("got clause\n  %s\nwant\n  %s", clause, tt.wantClause)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	keys := []sortKey{{Expression: "a", Type: "integer"}, {Expression: "id", Type: "uuid"}}
+	cursor := pageCursor{Order: orderFingerprint(keys), Values: []*string{nil, str("x")}, Before: true}
+
+	got, err := decodeCursor(encodeCursor(cursor), keys)
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	if !reflect.DeepEqual(*got, cursor) {
+		t.Errorf("got cursor %+v, want %+v", *got, cursor)
+	}
+
+	other := []sortKey{{Expression: "a", Type: "integer", Desc: true}, {Expression: "id", Type: "uuid"}}
+	if _, err := decodeCursor(encodeCursor(cursor), other); err == nil {
+		t.Error("a cursor of another order was accepted")
+	}
+	if _, err := decodeCursor("not a cursor", keys); err != errInvalidCursor {
+		t.Errorf("got error %v, want errInvalidCursor", err)
+	}
+}
+
+// testRow is a row of the paging test, keyed by column
+type testRow struct {
+	id     uuid.UUID
+	values map[string]*string
+}
+
+// value returns a column of the row as text, as keysetCursors reads it
+func (r testRow) value(column string) *string {
+	if column == "id" {
+		return str(r.id.String())
+	}
+	return r.values[column]
+}
+
+// compareSQLValues compares two non-NULL values of an SQL type
+func compareSQLValues(a, b, sqlType string) int {
+	if sqlType == "integer" {
+		x, _ := strconv.Atoi(a)
+		y, _ := strconv.Atoi(b)
+		return x - y
+	}
+	return strings.Compare(a, b)
+}
+
+var (
+	isNullTerm    = regexp.MustCompile(`^(\w+) IS NULL$`)
+	isNotNullTerm = regexp.MustCompile(`^(\w+) IS NOT NULL$`)
+	compareTerm   = regexp.MustCompile(`^(\w+) ([=<]) CAST\(\? AS (\w+)\)$`)
+	greaterTerm   = regexp.MustCompile(`^\((\w+) > CAST\(\? AS (\w+)\) OR (\w+) IS NULL\)$`)
+)
+
+// matchesClause evaluates a keysetClause predicate on a row. Comparisons with
+// NULL are not true, as in SQL.
+func matchesClause(t *testing.T, clause string, args []interface{}, row testRow) bool {
+	t.Helper()
+	if clause == "FALSE" {
+		return false
+	}
+	clause = strings.TrimSuffix(strings.TrimPrefix(clause, "(("), "))")
+
+	matched := false
+	for _, alternative := range strings.Split(clause, ") OR (") {
+		all := true
+		for _, term := range strings.Split(alternative, " AND ") {
+			var ok bool
+			switch {
+			case isNullTerm.MatchString(term):
+				ok = row.value(isNullTerm.FindStringSubmatch(term)[1]) == nil
+			case isNotNullTerm.MatchString(term):
+				ok = row.value(isNotNullTerm.FindStringSubmatch(term)[1]) != nil
+			case compareTerm.MatchString(term):
+				m := compareTerm.FindStringSubmatch(term)
+				arg := args[0].(string)
+				args = args[1:]
+				if v := row.value(m[1]); v != nil {
+					c := compareSQLValues(*v, arg, m[3])
+					ok = (m[2] == "=" && c == 0) || (m[2] == "<" && c < 0)
+				}
+			case greaterTerm.MatchString(term):
+				m := greaterTerm.FindStringSubmatch(term)
+				arg := args[0].(string)
+				args = args[1:]
+				v := row.value(m[1])
+				ok = v == nil || compareSQLValues(*v, arg, m[2]) > 0
+			default:
+				t.Fatalf("unexpected term %q", term)
+			}
+			all = all && ok
+		}
+		matched = matched || all
+	}
+	if len(args) != 0 {
+		t.Fatalf("%d arguments left over", len(args))
+	}
+	return matched
+}
+
+// sortRows sorts rows by an ORDER BY of orderClause, with Postgres' NULLS LAST
+// for ascending and NULLS FIRST for descending terms
+func sortRows(t *testing.T, rows []testRow, keys []sortKey, order string) {
+	t.Helper()
+	terms := strings.Split(order, ", ")
+	if len(terms) != len(keys) {
+		t.Fatalf("order %q does not match the keys", order)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k, key := range keys {
+			desc := strings.HasSuffix(terms[k], " DESC")
+			a, b := rows[i].value(key.Expression), rows[j].value(key.Expression)
+			var c int
+			switch {
+			case a == nil && b == nil:
+				c = 0
+			case a == nil:
+				c = 1
+			case b == nil:
+				c = -1
+			default:
+				c = compareSQLValues(*a, *b, key.Type)
+			}
+			if desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// fetchPage runs a page like GetContentEntries does, on rows in memory
+func fetchPage(t *testing.T, rows []testRow, keys []sortKey, raw string, limit int) (page []testRow, next, prev string) {
+	t.Helper()
+	var cursor *pageCursor
+	if raw != "" {
+		var err error
+		if cursor, err = decodeCursor(raw, keys); err != nil {
+			t.Fatalf("decodeCursor: %v", err)
+		}
+	}
+	before := cursor != nil && cursor.Before
+
+	for _, row := range rows {
+		if cursor != nil {
+			clause, args := keysetClause(keys, cursor.Values, before)
+			if !matchesClause(t, clause, args, row) {
+				continue
+			}
+		}
+		page = append(page, row)
+	}
+	sortRows(t, page, keys, orderClause(keys, before))
+
+	hasMore := len(page) > limit
+	if hasMore {
+		page = page[:limit]
+	}
+	if before {
+		slices.Reverse(page)
+	}
+	if len(page) == 0 {
+		return page, "", ""
+	}
+
+	byID := make(map[uuid.UUID]testRow)
+	for _, row := range rows {
+		byID[row.id] = row
+	}
+	next, prev, err := pageCursors(keys, cursor, hasMore, page[0].id, page[len(page)-1].id, func(id uuid.UUID) ([]*string, error) {
+		values := make([]*string, len(keys))
+		for i, key := range keys {
+			values[i] = byID[id].value(key.Expression)
+		}
+		return values, nil
+	})
+	if err != nil {
+		t.Fatalf("pageCursors: %v", err)
+	}
+	return page, next, prev
+}
+
+func ids(rows []testRow) []uuid.UUID {
+	result := make([]uuid.UUID, len(rows))
+	for i, row := range rows {
+		result[i] = row.id
+	}
+	return result
+}
+
+// TestKeysetPagingRoundTrip pages forward through rows with NULLs and ties,
+// then back again, and checks that every row is seen once in order
+func TestKeysetPagingRoundTrip(t *testing.T) {
+	var rows []testRow
+	for i, v := range []struct{ a, b *string }{
+		{str("3"), str("x")},
+		{nil, str("y")},
+		{str("1"), nil},
+		{str("3"), str("x")},
+		{nil, nil},
+		{str("2"), str("y")},
+		{str("3"), nil},
+		{nil, str("x")},
+		{str("1"), str("x")},
+		{str("10"), str("z")},
+		{nil, nil},
+	} {
+		rows = append(rows, testRow{
+			id:     uuid.MustParse("00000000-0000-0000-0000-0000000000" + strconv.Itoa(10+i)),
+			values: map[string]*string{"a": v.a, "b": v.b},
+		})
+	}
+
+	orders := map[string][]sortKey{
+		"asc, desc":  {{Expression: "a", Type: "integer"}, {Expression: "b", Type: "text", Desc: true}, {Expression: "id", Type: "uuid"}},
+		"desc, asc":  {{Expression: "a", Type: "integer", Desc: true}, {Expression: "b", Type: "text"}, {Expression: "id", Type: "uuid"}},
+		"desc, desc": {{Expression: "a", Type: "integer", Desc: true}, {Expression: "b", Type: "text", Desc: true}, {Expression: "id", Type: "uuid", Desc: true}},
+	}
+
+	for name, keys := range orders {
+		for _, limit := range []int{1, 2, 3, 4} {
+			want := slices.Clone(rows)
+			sortRows(t, want, keys, orderClause(keys, false))
+
+			// Forward from the start
+			var forward [][]testRow
+			page, next, prev := fetchPage(t, rows, keys, "", limit)
+			if prev != "" {
+				t.Errorf("%s, limit %d: the first page has a previous cursor", name, limit)
+			}
+			forward = append(forward, page)
+			for next != "" {
+				page, next, prev = fetchPage(t, rows, keys, next, limit)
+				if prev == "" {
+					t.Errorf("%s, limit %d: page %d has no previous cursor", name, limit, len(forward))
+				}
+				forward = append(forward, page)
+				if len(forward) > len(rows) {
+					t.Fatalf("%s, limit %d: paging does not end", name, limit)
+				}
+			}
+			if got := ids(slices.Concat(forward...)); !reflect.DeepEqual(got, ids(want)) {
+				t.Errorf("%s, limit %d: forward got %v, want %v", name, limit, got, ids(want))
+				continue
+			}
+
+			// Back from the last page, which must give the same pages
+			for i := len(forward) - 2; i >= 0; i-- {
+				page, next, prev = fetchPage(t, rows, keys, prev, limit)
+				if !reflect.DeepEqual(ids(page), ids(forward[i])) {
+					t.Errorf("%s, limit %d: back to page %d got %v, want %v", name, limit, i, ids(page), ids(forward[i]))
+				}
+				if next == "" {
+					t.Errorf("%s, limit %d: page %d has no next cursor going back", name, limit, i)
+				}
+			}
+			if prev != "" && len(forward) > 1 {
+				t.Errorf("%s, limit %d: the first page reached going back has a previous cursor", name, limit)
+			}
+		}
+	}
+}
@@ -2,22 +2,62 @@ package handler
 
 import (
 	"bufio"
+	"contentive/internal/config"
+	"contentive/internal/database"
 	"contentive/internal/llm"
+	"contentive/internal/llm/tools"
 	"contentive/internal/logger"
+	"contentive/internal/models"
+	"contentive/internal/rag"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
-// LLMChatRequest is a struct that contains the request for the LLM chat
+// LLMChatRequest is a struct that contains the request for the LLM chat.
+// Either messages or prompt is required; prompt is sent as the last user message.
 type LLMChatRequest struct {
-	Prompt      string  `json:"prompt"`
-	MaxTokens   int     `json:"max_tokens,omitempty"`
-	Temperature float64 `json:"temperature,omitempty"`
-	TopP        float64 `json:"top_p,omitempty"`
-	Model       string  `json:"model,omitempty"`
+	System      string        `json:"system,omitempty"`   // system prompt, sent before the messages
+	Messages    []llm.Message `json:"messages,omitempty"` // conversation history, in order
+	Prompt      string        `json:"prompt,omitempty"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Temperature *float64      `json:"temperature,omitempty"`
+	TopP        float64       `json:"top_p,omitempty"`
+	Model       string        `json:"model,omitempty"`
+	UseTools    bool          `json:"use_tools,omitempty"` // let the model read content through the built-in tools
+	NoCache     bool          `json:"no_cache,omitempty"`  // always ask the model, even for a cached request
+}
+
+// toLLMRequest validates the chat request and converts it to an LLM request
+func (r LLMChatRequest) toLLMRequest() (llm.LLMRequest, error) {
+	if r.Prompt == "" && len(r.Messages) == 0 {
+		return llm.LLMRequest{}, errors.New("prompt or messages are required")
+	}
+	if err := llm.ValidateMessages(r.Messages); err != nil {
+		return llm.LLMRequest{}, err
+	}
+
+	var messages []llm.Message
+	if r.System != "" {
+		messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: r.System})
+	}
+	messages = append(messages, r.Messages...)
+
+	return llm.LLMRequest{
+		Messages:    messages,
+		Prompt:      r.Prompt,
+		MaxTokens:   r.MaxTokens,
+		Temperature: r.Temperature,
+		TopP:        r.TopP,
+		Model:       r.Model,
+		NoCache:     r.NoCache,
+	}, nil
 }
 
 // LLMChat is a handler that handles the LLM chat request
@@ -30,22 +70,15 @@ func LLMChat(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Prompt == "" {
+	llmReq, err := req.toLLMRequest()
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Prompt is required",
+			"error": err.Error(),
 		})
 	}
 
-	llmReq := llm.LLMRequest{
-		Prompt:      req.Prompt,
-		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
-		TopP:        req.TopP,
-		Model:       req.Model,
-	}
-
 	// Get the LLM provider
-	provider := llm.GetProvider()
+	provider := meteredProvider(c)
 	if provider == nil {
 		logger.Error("LLM provider not initialized")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -53,17 +86,40 @@ func LLMChat(c *fiber.Ctx) error {
 		})
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	var resp *llm.LLMResponse
+	if req.UseTools {
+		apiUser, ok := c.Locals("user").(models.APIUser)
+		if !ok {
+			logger.Error("User is not an API user")
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "User is not an API user",
+			})
+		}
 
-	resp, err := provider.Chat(ctx, llmReq)
+		// Tool calls need several round trips to the model
+		ctx, cancel := llmContext(config.AppConfig.LLM_TOOLS_TIMEOUT)
+		defer cancel()
+		resp, err = llm.ChatWithTools(ctx, provider, llmReq, tools.ContentTools(apiUser), llm.DefaultMaxToolRounds)
+	} else {
+		ctx, cancel := llmContext(config.AppConfig.LLM_CHAT_TIMEOUT)
+		defer cancel()
+		resp, err = provider.Chat(ctx, llmReq)
+	}
 	if err != nil {
 		logger.Error("LLM chat error: %v", err)
+		if errors.Is(err, llm.ErrUnavailable) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "LLM service temporarily unavailable",
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get response from LLM",
 		})
 	}
 
+	if resp.Cache != "" {
+		c.Set("X-LLM-Cache", resp.Cache)
+	}
 	return c.JSON(resp)
 }
 
@@ -77,22 +133,21 @@ func LLMChatStream(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Prompt == "" {
+	if req.UseTools {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Prompt is required",
+			"error": "use_tools is not supported for streaming, use /llm/chat instead",
 		})
 	}
 
-	llmReq := llm.LLMRequest{
-		Prompt:      req.Prompt,
-		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
-		TopP:        req.TopP,
-		Model:       req.Model,
-		Stream:      true,
+	llmReq, err := req.toLLMRequest()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
 	}
+	llmReq.Stream = true
 
-	provider := llm.GetProvider()
+	provider := meteredProvider(c)
 	if provider == nil {
 		logger.Error("LLM provider not initialized")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -100,69 +155,357 @@ func LLMChatStream(c *fiber.Ctx) error {
 		})
 	}
 
-	c.Set("Content-Type", "text/event-stream")
-	c.Set("Cache-Control", "no-cache")
-	c.Set("Connection", "keep-alive")
-	c.Set("Transfer-Encoding", "chunked")
-
-	done := make(chan bool)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
+	ctx, cancel := llmContext(config.AppConfig.LLM_STREAM_TIMEOUT)
 
 	stream, err := provider.ChatStream(ctx, llmReq)
 	if err != nil {
+		cancel()
 		logger.Error("LLM chat stream error: %v", err)
+		if errors.Is(err, llm.ErrUnavailable) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "LLM service temporarily unavailable",
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get stream from LLM",
 		})
 	}
 
+	writeLLMStream(c, ctx, cancel, stream, nil)
+	return nil
+}
+
+// llmContext returns the context of an LLM call. It ends after the given
+// number of seconds, 0 meaning no limit, or when it is cancelled. fasthttp does
+// not report a client that disconnects, so a call that is not streamed runs
+// until it answers or times out; writeLLMStream cancels a stream as soon as a
+// write to the client fails.
+func llmContext(seconds int) (context.Context, context.CancelFunc) {
+	if seconds <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), time.Duration(seconds)*time.Second)
+}
+
+// writeLLMStream relays the stream to the client as server-sent events. The body
+// is written after the handler returns, so the writer owns cancel. Idle streams
+// get heartbeat comments, and a failed write means the client is gone, which
+// cancels the upstream request. If finalize is set, it builds the payload of the
+// last event from the final stream response.
+func writeLLMStream(c *fiber.Ctx, ctx context.Context, cancel context.CancelFunc, stream <-chan llm.LLMStreamResponse, finalize func(llm.LLMStreamResponse) interface{}) {
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("Transfer-Encoding", "chunked")
+
+	// Keep a proxy from buffering the events
+	c.Set("X-Accel-Buffering", "no")
+
+	heartbeat := time.Duration(config.AppConfig.LLM_SSE_HEARTBEAT) * time.Second
+	remote := c.IP()
+
 	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
-		defer close(done)
+		defer cancel()
+
+		write := func(chunk string) error {
+			if _, err := w.WriteString(chunk); err != nil {
+				return err
+			}
+			return w.Flush()
+		}
+		writeEvent := func(payload interface{}) error {
+			data, _ := json.Marshal(payload)
+			return write("data: " + string(data) + "\n\n")
+		}
+
+		// A nil channel never fires, so there are no heartbeats when disabled
+		var ticks <-chan time.Time
+		if heartbeat > 0 {
+			ticker := time.NewTicker(heartbeat)
+			defer ticker.Stop()
+			ticks = ticker.C
+		}
 
 		for {
+			var err error
 			select {
 			case <-ctx.Done():
-				data, _ := json.Marshal(fiber.Map{"done": true, "error": "Request timeout"})
-				w.Write([]byte("data: " + string(data) + "\n\n"))
-				w.Flush()
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					writeEvent(fiber.Map{"done": true, "error": "Request timeout"})
+				}
 				return
+			case <-ticks:
+				// SSE comment, ignored by clients
+				err = write(": heartbeat\n\n")
 			case resp, ok := <-stream:
 				if !ok {
-					data, _ := json.Marshal(fiber.Map{"done": true})
-					w.Write([]byte("data: " + string(data) + "\n\n"))
-					w.Flush()
-					return
+					resp = llm.LLMStreamResponse{Done: true}
 				}
 
-				data, _ := json.Marshal(resp)
-				w.Write([]byte("data: " + string(data) + "\n\n"))
-				w.Flush()
+				if resp.Done && finalize != nil {
+					err = writeEvent(finalize(resp))
+				} else if !ok {
+					err = writeEvent(fiber.Map{"done": true})
+				} else {
+					err = writeEvent(resp)
+				}
 
 				if resp.Done {
 					return
 				}
 			}
+
+			if err != nil {
+				logger.Warning("LLM stream to %s closed, client disconnected: %v", remote, err)
+				return
+			}
 		}
 	})
+}
 
-	<-done
-	return nil
+// LLMKnowledgeQueryRequest is a struct that contains the request for the LLM knowledge query
+type LLMKnowledgeQueryRequest struct {
+	Question    string   `json:"question"`
+	Schemas     []string `json:"schemas,omitempty"` // schema slugs to search, defaults to every readable schema
+	TopK        int      `json:"top_k,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        float64  `json:"top_p,omitempty"`
+	Model       string   `json:"model,omitempty"`
+}
+
+// LLMCitation points at the content a knowledge answer was grounded on
+type LLMCitation struct {
+	Index       int     `json:"index"` // the [n] marker used in the answer
+	SchemaSlug  string  `json:"schema_slug"`
+	ContentSlug string  `json:"content_slug"`
+	Version     int     `json:"version"`
+	Score       float64 `json:"score"`
+}
+
+// LLMKnowledgeQueryResponse is the LLM answer together with its citations
+type LLMKnowledgeQueryResponse struct {
+	llm.LLMResponse
+	Citations []LLMCitation `json:"citations"`
+}
+
+// LLMKnowledgeStreamResponse is the last event of a knowledge query stream
+type LLMKnowledgeStreamResponse struct {
+	llm.LLMStreamResponse
+	Citations []LLMCitation `json:"citations"`
+}
+
+const (
+	defaultKnowledgeTopK = 5
+	maxKnowledgeTopK     = 20
+)
+
+// readableSchemaIDs returns the IDs of the requested schemas the API user may read.
+// When no slugs are requested, every schema the user may read is returned.
+func readableSchemaIDs(apiUser models.APIUser, slugs []string) ([]uuid.UUID, error) {
+	var schemas []models.Schema
+	db := database.DB
+	if len(slugs) > 0 {
+		db = db.Where("slug IN ?", slugs)
+	}
+	if err := db.Find(&schemas).Error; err != nil {
+		return nil, err
+	}
+
+	var ids []uuid.UUID
+	for _, schema := range schemas {
+		if apiUser.HasScope(schema.Slug + ":read") {
+			ids = append(ids, schema.ID)
+		}
+	}
+	return ids, nil
+}
+
+// buildKnowledgePrompt numbers the retrieved content and wraps it around the question.
+// Chunks of the same content version share one citation.
+func buildKnowledgePrompt(question string, chunks []rag.Chunk) (string, []LLMCitation) {
+	citations := []LLMCitation{}
+	citationIndex := make(map[string]int)
+	sources := make(map[int][]string)
+
+	for _, chunk := range chunks {
+		key := fmt.Sprintf("%s/%s@%d", chunk.SchemaSlug, chunk.ContentSlug, chunk.Version)
+		index, exists := citationIndex[key]
+		if !exists {
+			index = len(citations) + 1
+			citationIndex[key] = index
+			citations = append(citations, LLMCitation{
+				Index:       index,
+				SchemaSlug:  chunk.SchemaSlug,
+				ContentSlug: chunk.ContentSlug,
+				Version:     chunk.Version,
+				Score:       chunk.Score,
+			})
+		}
+		sources[index] = append(sources[index], chunk.Content)
+	}
+
+	var b strings.Builder
+	b.WriteString("Answer the question using only the context below. ")
+	b.WriteString("Cite the sources you use with their [n] markers. ")
+	b.WriteString("If the context does not contain the answer, say that you don't know.\n\n")
+	b.WriteString("Context:\n")
+	if len(citations) == 0 {
+		b.WriteString("(no relevant content found)\n")
+	}
+	for _, citation := range citations {
+		fmt.Fprintf(&b, "[%d] %s/%s (version %d)\n", citation.Index, citation.SchemaSlug, citation.ContentSlug, citation.Version)
+		for _, content := range sources[citation.Index] {
+			b.WriteString(content)
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Question: ")
+	b.WriteString(question)
+
+	return b.String(), citations
+}
+
+// prepareKnowledgeQuery parses the request, retrieves the relevant content and
+// builds the LLM request. On failure the error response has already been sent.
+func prepareKnowledgeQuery(c *fiber.Ctx, ctx context.Context) (*llm.LLMRequest, []LLMCitation, error) {
+	var req LLMKnowledgeQueryRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse LLM knowledge query request: %v", err)
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if strings.TrimSpace(req.Question) == "" {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Question is required",
+		})
+	}
+
+	if req.TopK <= 0 {
+		req.TopK = defaultKnowledgeTopK
+	} else if req.TopK > maxKnowledgeTopK {
+		req.TopK = maxKnowledgeTopK
+	}
+
+	apiUser, ok := c.Locals("user").(models.APIUser)
+	if !ok {
+		logger.Error("User is not an API user")
+		return nil, nil, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "User is not an API user",
+		})
+	}
+
+	schemaIDs, err := readableSchemaIDs(apiUser, req.Schemas)
+	if err != nil {
+		logger.Error("Failed to fetch schemas: %v", err)
+		return nil, nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch schemas",
+		})
+	}
+	if len(schemaIDs) == 0 {
+		logger.Error("API user %s cannot read any of the requested schemas", apiUser.Name)
+		return nil, nil, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Insufficient permissions",
+		})
+	}
+
+	chunks, err := rag.Search(ctx, req.Question, schemaIDs, req.TopK)
+	if err != nil {
+		logger.Error("Knowledge retrieval error: %v", err)
+		return nil, nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve knowledge",
+		})
+	}
+
+	prompt, citations := buildKnowledgePrompt(req.Question, chunks)
+
+	return &llm.LLMRequest{
+		Prompt:      prompt,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Model:       req.Model,
+	}, citations, nil
 }
 
 // LLMKnowledgeQuery is a handler that handles the LLM knowledge query request
 func LLMKnowledgeQuery(c *fiber.Ctx) error {
-	// TODO: RAG query endpoint
-	return c.JSON(fiber.Map{
-		"message": "Knowledge query endpoint - To be implemented",
+	provider := meteredProvider(c)
+	if provider == nil {
+		logger.Error("LLM provider not initialized")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "LLM service not available",
+		})
+	}
+
+	ctx, cancel := llmContext(config.AppConfig.LLM_CHAT_TIMEOUT)
+	defer cancel()
+
+	llmReq, citations, err := prepareKnowledgeQuery(c, ctx)
+	if llmReq == nil {
+		return err
+	}
+
+	resp, err := provider.Chat(ctx, *llmReq)
+	if err != nil {
+		logger.Error("LLM knowledge query error: %v", err)
+		if errors.Is(err, llm.ErrUnavailable) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "LLM service temporarily unavailable",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get response from LLM",
+		})
+	}
+
+	return c.JSON(LLMKnowledgeQueryResponse{
+		LLMResponse: *resp,
+		Citations:   citations,
 	})
 }
 
 // LLMKnowledgeQueryStream is a handler that handles the LLM knowledge query stream request
 func LLMKnowledgeQueryStream(c *fiber.Ctx) error {
-	// TODO: RAG query stream endpoint
-	return c.JSON(fiber.Map{
-		"message": "Knowledge query stream endpoint - To be implemented",
+	provider := meteredProvider(c)
+	if provider == nil {
+		logger.Error("LLM provider not initialized")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "LLM service not available",
+		})
+	}
+
+	ctx, cancel := llmContext(config.AppConfig.LLM_STREAM_TIMEOUT)
+
+	llmReq, citations, err := prepareKnowledgeQuery(c, ctx)
+	if llmReq == nil {
+		cancel()
+		return err
+	}
+	llmReq.Stream = true
+
+	stream, err := provider.ChatStream(ctx, *llmReq)
+	if err != nil {
+		cancel()
+		logger.Error("LLM knowledge query stream error: %v", err)
+		if errors.Is(err, llm.ErrUnavailable) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "LLM service temporarily unavailable",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get stream from LLM",
+		})
+	}
+
+	writeLLMStream(c, ctx, cancel, stream, func(resp llm.LLMStreamResponse) interface{} {
+		return LLMKnowledgeStreamResponse{
+			LLMStreamResponse: resp,
+			Citations:         citations,
+		}
 	})
+	return nil
 }
@@ -0,0 +1,457 @@
+package handler
+
+import (
+	"contentive/internal/config"
+	"contentive/internal/database"
+	"contentive/internal/llm"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// conversationTitleLength is the number of characters of the first message used as title
+const conversationTitleLength = 50
+
+// ConversationRequest is the request to create a conversation
+type ConversationRequest struct {
+	Title  string `json:"title"`
+	System string `json:"system"`
+	Model  string `json:"model"`
+}
+
+// ConversationMessageRequest is the request to append a message to a conversation
+type ConversationMessageRequest struct {
+	Content     string   `json:"content"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        float64  `json:"top_p,omitempty"`
+	Model       string   `json:"model,omitempty"`
+}
+
+// ConversationMessageResponse holds the stored user message and the reply
+type ConversationMessageResponse struct {
+	UserMessage      models.Message `json:"user_message"`
+	AssistantMessage models.Message `json:"assistant_message"`
+}
+
+// ConversationStreamResponse is the last event of a conversation stream
+type ConversationStreamResponse struct {
+	llm.LLMStreamResponse
+	UserMessage      *models.Message `json:"user_message,omitempty"`
+	AssistantMessage *models.Message `json:"assistant_message,omitempty"`
+}
+
+// ConversationQuery represents the query parameters for the ListConversations handler
+type ConversationQuery struct {
+	Page     int `query:"page"`
+	PageSize int `query:"page_size"`
+}
+
+// findConversation loads a conversation of the calling API user. On failure the
+// error response has already been sent and the returned conversation is nil.
+func findConversation(c *fiber.Ctx) (*models.Conversation, error) {
+	apiUser, ok := c.Locals("user").(models.APIUser)
+	if !ok {
+		logger.Error("User is not an API user")
+		return nil, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "User is not an API user",
+		})
+	}
+
+	var conversation models.Conversation
+	if err := database.DB.Where("id = ? AND api_user_id = ?", c.Params("conversation_id"), apiUser.ID).
+		First(&conversation).Error; err != nil {
+		logger.Error("Conversation not found: %v", err)
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+	return &conversation, nil
+}
+
+// CreateConversation creates a conversation for the calling API user
+func CreateConversation(c *fiber.Ctx) error {
+	apiUser, ok := c.Locals("user").(models.APIUser)
+	if !ok {
+		logger.Error("User is not an API user")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "User is not an API user",
+		})
+	}
+
+	var req ConversationRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse conversation request: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	conversation := models.Conversation{
+		APIUserID: apiUser.ID,
+		Title:     truncateRunes(strings.TrimSpace(req.Title), 255),
+		System:    req.System,
+		Model:     req.Model,
+	}
+	if err := database.DB.Create(&conversation).Error; err != nil {
+		logger.Error("Failed to create conversation: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create conversation",
+		})
+	}
+
+	logger.APIAction(apiUser.ID, apiUser.Name, "CREATE_CONVERSATION", "Created conversation "+conversation.ID.String())
+
+	return c.Status(fiber.StatusCreated).JSON(conversation)
+}
+
+// ListConversations lists the conversations of the calling API user, most recent first
+func ListConversations(c *fiber.Ctx) error {
+	apiUser, ok := c.Locals("user").(models.APIUser)
+	if !ok {
+		logger.Error("User is not an API user")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "User is not an API user",
+		})
+	}
+
+	query := new(ConversationQuery)
+	if err := c.QueryParser(query); err != nil {
+		logger.Error("Error parsing query parameters: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid query parameters",
+		})
+	}
+
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.PageSize <= 0 {
+		query.PageSize = 20
+	} else if query.PageSize > 100 {
+		query.PageSize = 100
+	}
+
+	db := database.DB.Model(&models.Conversation{}).Where("api_user_id = ?", apiUser.ID)
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		logger.Error("Error counting conversations: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count conversations",
+		})
+	}
+
+	var conversations []models.Conversation
+	if err := db.Order("updated_at DESC").
+		Offset((query.Page - 1) * query.PageSize).
+		Limit(query.PageSize).
+		Find(&conversations).Error; err != nil {
+		logger.Error("Failed to get conversations: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get conversations",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": conversations,
+		"pagination": fiber.Map{
+			"current_page": query.Page,
+			"page_size":    query.PageSize,
+			"total_pages":  (total + int64(query.PageSize) - 1) / int64(query.PageSize),
+			"total":        total,
+		},
+	})
+}
+
+// GetConversation gets a conversation with all of its messages
+func GetConversation(c *fiber.Ctx) error {
+	conversation, err := findConversation(c)
+	if conversation == nil {
+		return err
+	}
+
+	if err := database.DB.Where("conversation_id = ?", conversation.ID).
+		Order("created_at ASC").
+		Find(&conversation.Messages).Error; err != nil {
+		logger.Error("Failed to get conversation messages: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get conversation messages",
+		})
+	}
+
+	return c.JSON(conversation)
+}
+
+// DeleteConversation deletes a conversation and its messages
+func DeleteConversation(c *fiber.Ctx) error {
+	conversation, err := findConversation(c)
+	if conversation == nil {
+		return err
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Where("conversation_id = ?", conversation.ID).Delete(&models.Message{}).Error; err != nil {
+		tx.Rollback()
+		logger.Error("Failed to delete conversation messages: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete conversation",
+		})
+	}
+	if err := tx.Delete(conversation).Error; err != nil {
+		tx.Rollback()
+		logger.Error("Failed to delete conversation: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete conversation",
+		})
+	}
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("Error committing transaction: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete conversation",
+		})
+	}
+
+	apiUser := c.Locals("user").(models.APIUser)
+	logger.APIAction(apiUser.ID, apiUser.Name, "DELETE_CONVERSATION", "Deleted conversation "+conversation.ID.String())
+
+	return c.JSON(fiber.Map{
+		"message": "Conversation deleted successfully",
+	})
+}
+
+// prepareConversationMessage parses the message, loads the conversation and
+// builds the LLM request from its history, truncated to the configured token
+// budget. On failure the error response has already been sent.
+func prepareConversationMessage(c *fiber.Ctx) (*models.Conversation, *llm.LLMRequest, string, error) {
+	var req ConversationMessageRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse conversation message: %v", err)
+		return nil, nil, "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if strings.TrimSpace(req.Content) == "" {
+		return nil, nil, "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Content is required",
+		})
+	}
+
+	conversation, err := findConversation(c)
+	if conversation == nil {
+		return nil, nil, "", err
+	}
+
+	var history []models.Message
+	if err := database.DB.Where("conversation_id = ?", conversation.ID).
+		Order("created_at ASC").
+		Find(&history).Error; err != nil {
+		logger.Error("Failed to get conversation messages: %v", err)
+		return nil, nil, "", c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get conversation messages",
+		})
+	}
+
+	messages := make([]llm.Message, 0, len(history)+2)
+	if conversation.System != "" {
+		messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: conversation.System})
+	}
+	for _, message := range history {
+		messages = append(messages, llm.Message{Role: message.Role, Content: message.Content})
+	}
+	messages = append(messages, llm.Message{Role: llm.RoleUser, Content: req.Content})
+
+	model := conversation.Model
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	return conversation, &llm.LLMRequest{
+		Messages:    llm.TruncateMessages(messages, config.AppConfig.LLM_HISTORY_TOKENS),
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Model:       model,
+	}, req.Content, nil
+}
+
+// saveConversationTurn stores the user message and the reply in one transaction.
+// A conversation without a title is named after its first message.
+func saveConversationTurn(conversation *models.Conversation, content, reply, finishReason string) (*ConversationMessageResponse, error) {
+	turn := &ConversationMessageResponse{
+		UserMessage: models.Message{
+			ConversationID: conversation.ID,
+			Role:           llm.RoleUser,
+			Content:        content,
+		},
+		AssistantMessage: models.Message{
+			ConversationID: conversation.ID,
+			Role:           llm.RoleAssistant,
+			Content:        reply,
+			FinishReason:   finishReason,
+		},
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&turn.UserMessage).Error; err != nil {
+			return err
+		}
+		// Keep the reply strictly after the user message
+		turn.AssistantMessage.CreatedAt = turn.UserMessage.CreatedAt.Add(time.Microsecond)
+		if err := tx.Create(&turn.AssistantMessage).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"updated_at": time.Now()}
+		if conversation.Title == "" {
+			updates["title"] = truncateRunes(strings.TrimSpace(content), conversationTitleLength)
+		}
+		return tx.Model(conversation).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return turn, nil
+}
+
+// AppendConversationMessage sends a message in a conversation and stores the reply
+func AppendConversationMessage(c *fiber.Ctx) error {
+	provider := meteredProvider(c)
+	if provider == nil {
+		logger.Error("LLM provider not initialized")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "LLM service not available",
+		})
+	}
+
+	conversation, llmReq, content, err := prepareConversationMessage(c)
+	if conversation == nil {
+		return err
+	}
+
+	ctx, cancel := llmContext(config.AppConfig.LLM_CHAT_TIMEOUT)
+	defer cancel()
+
+	resp, err := provider.Chat(ctx, *llmReq)
+	if err != nil {
+		logger.Error("LLM conversation error: %v", err)
+		if errors.Is(err, llm.ErrUnavailable) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "LLM service temporarily unavailable",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get response from LLM",
+		})
+	}
+
+	turn, err := saveConversationTurn(conversation, content, resp.Text, resp.FinishReason)
+	if err != nil {
+		logger.Error("Failed to save conversation messages: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save conversation messages",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(turn)
+}
+
+// AppendConversationMessageStream sends a message in a conversation and streams
+// the reply. The turn is stored once the reply is complete.
+func AppendConversationMessageStream(c *fiber.Ctx) error {
+	provider := meteredProvider(c)
+	if provider == nil {
+		logger.Error("LLM provider not initialized")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "LLM service not available",
+		})
+	}
+
+	conversation, llmReq, content, err := prepareConversationMessage(c)
+	if conversation == nil {
+		return err
+	}
+	llmReq.Stream = true
+
+	ctx, cancel := llmContext(config.AppConfig.LLM_STREAM_TIMEOUT)
+
+	stream, err := provider.ChatStream(ctx, *llmReq)
+	if err != nil {
+		cancel()
+		logger.Error("LLM conversation stream error: %v", err)
+		if errors.Is(err, llm.ErrUnavailable) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "LLM service temporarily unavailable",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get stream from LLM",
+		})
+	}
+
+	// Collect the reply while relaying it, and store the turn before the last event
+	var turn *ConversationMessageResponse
+	relayed := make(chan llm.LLMStreamResponse)
+	go func() {
+		defer close(relayed)
+		var reply strings.Builder
+		for {
+			var resp llm.LLMStreamResponse
+			var ok bool
+			select {
+			case <-ctx.Done():
+				return
+			case resp, ok = <-stream:
+			}
+			if !ok {
+				resp = llm.LLMStreamResponse{Done: true, Error: llm.StreamIncomplete}
+			}
+			reply.WriteString(resp.Text)
+
+			// A failed or cut off reply is not stored, the conversation stays as it was
+			if resp.Done && resp.Error == "" && resp.FinishReason != "" {
+				saved, err := saveConversationTurn(conversation, content, reply.String(), resp.FinishReason)
+				if err != nil {
+					logger.Error("Failed to save conversation messages: %v", err)
+				}
+				turn = saved
+			} else if resp.Done {
+				logger.Error("LLM conversation stream failed, the turn is not saved: %q, finish reason %q", resp.Error, resp.FinishReason)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case relayed <- resp:
+			}
+			if resp.Done {
+				return
+			}
+		}
+	}()
+
+	writeLLMStream(c, ctx, cancel, relayed, func(resp llm.LLMStreamResponse) interface{} {
+		final := ConversationStreamResponse{LLMStreamResponse: resp}
+		if turn != nil {
+			final.UserMessage = &turn.UserMessage
+			final.AssistantMessage = &turn.AssistantMessage
+		}
+		return final
+	})
+	return nil
+}
+
+// truncateRunes shortens s to at most n characters
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
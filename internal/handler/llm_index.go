@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"contentive/internal/database"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"contentive/internal/rag"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetKnowledgeIndexStatus reports the indexing queue and the lag of each schema
+func GetKnowledgeIndexStatus(c *fiber.Ctx) error {
+	status, err := rag.Status()
+	if err != nil {
+		logger.Error("Failed to get knowledge index status: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get knowledge index status",
+		})
+	}
+
+	return c.JSON(status)
+}
+
+// RebuildKnowledgeIndex forces every entry of a schema to be embedded again
+func RebuildKnowledgeIndex(c *fiber.Ctx) error {
+	schemaID := c.Params("schema_id")
+
+	var schema models.Schema
+	if err := database.DB.Where("id = ?", schemaID).First(&schema).Error; err != nil {
+		logger.Error("Schema not found: %v", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Schema not found",
+		})
+	}
+
+	queued, err := rag.EnqueueSchema(schema.ID, true)
+	if err != nil {
+		logger.Error("Failed to rebuild knowledge index: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to rebuild knowledge index",
+		})
+	}
+
+	currentUser := c.Locals("user").(models.AdminUser)
+	logger.AdminAction(
+		currentUser.ID,
+		currentUser.Name,
+		"REBUILD_KNOWLEDGE_INDEX",
+		fmt.Sprintf("Queued %d entries of schema %s for re-indexing", queued, schema.Name),
+	)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Knowledge index rebuild queued",
+		"schema":  schema.Slug,
+		"queued":  queued,
+	})
+}
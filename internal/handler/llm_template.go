@@ -0,0 +1,489 @@
+package handler
+
+import (
+	"contentive/internal/config"
+	"contentive/internal/database"
+	"contentive/internal/llm"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PromptTemplateRequest is the request to create a template or add a version.
+// When adding a version, fields that are left out are kept from the latest one.
+type PromptTemplateRequest struct {
+	Name        string   `json:"name"` // only used on create
+	Description *string  `json:"description"`
+	System      *string  `json:"system"`
+	Body        *string  `json:"body"`
+	Model       *string  `json:"model"`
+	MaxTokens   *int     `json:"max_tokens"`
+	Temperature *float64 `json:"temperature"`
+}
+
+// apply copies the fields that are set onto the template
+func (r PromptTemplateRequest) apply(template *models.PromptTemplate) {
+	if r.Description != nil {
+		template.Description = *r.Description
+	}
+	if r.System != nil {
+		template.System = *r.System
+	}
+	if r.Body != nil {
+		template.Body = *r.Body
+	}
+	if r.Model != nil {
+		template.Model = *r.Model
+	}
+	if r.MaxTokens != nil {
+		template.MaxTokens = *r.MaxTokens
+	}
+	if r.Temperature != nil {
+		template.Temperature = r.Temperature
+	}
+}
+
+// RunPromptTemplateRequest is the request to run a template
+type RunPromptTemplateRequest struct {
+	Version     int                    `json:"version,omitempty"` // defaults to the latest version
+	Variables   map[string]interface{} `json:"variables"`
+	Content     *TemplateContentRef    `json:"content,omitempty"` // entry the content.* variables are read from
+	MaxTokens   int                    `json:"max_tokens,omitempty"`
+	Temperature *float64               `json:"temperature,omitempty"`
+	TopP        float64                `json:"top_p,omitempty"`
+	Model       string                 `json:"model,omitempty"`
+	Stream      bool                   `json:"stream,omitempty"`
+}
+
+// TemplateContentRef points at a published content entry
+type TemplateContentRef struct {
+	Schema string `json:"schema"` // schema slug
+	Slug   string `json:"slug"`
+}
+
+// PromptTemplateRunResponse is the LLM answer to a template run
+type PromptTemplateRunResponse struct {
+	llm.LLMResponse
+	Template string `json:"template"`
+	Version  int    `json:"version"`
+}
+
+// PromptTemplateStreamResponse is the last event of a template run stream
+type PromptTemplateStreamResponse struct {
+	llm.LLMStreamResponse
+	Template string `json:"template"`
+	Version  int    `json:"version"`
+}
+
+// findPromptTemplate loads a version of a template, or the latest when version is 0
+func findPromptTemplate(name string, version int) (*models.PromptTemplate, error) {
+	db := database.DB.Where("name = ?", name)
+	if version > 0 {
+		db = db.Where("version = ?", version)
+	}
+
+	var template models.PromptTemplate
+	if err := db.Order("version DESC").First(&template).Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// CreatePromptTemplate creates version 1 of a template
+func CreatePromptTemplate(c *fiber.Ctx) error {
+	var req PromptTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse prompt template request: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var existing models.PromptTemplate
+	if err := database.DB.Where("name = ?", req.Name).First(&existing).Error; err == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Template '%s' already exists, update it to add a version", req.Name),
+		})
+	}
+
+	currentUser := c.Locals("user").(models.AdminUser)
+	template := models.PromptTemplate{
+		Name:        req.Name,
+		Version:     1,
+		CreatedByID: &currentUser.ID,
+	}
+	req.apply(&template)
+
+	if err := template.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := database.DB.Create(&template).Error; err != nil {
+		logger.Error("Failed to create prompt template: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create prompt template",
+		})
+	}
+
+	logger.AdminAction(
+		currentUser.ID,
+		currentUser.Name,
+		"CREATE_PROMPT_TEMPLATE",
+		"Created prompt template: "+template.Name,
+	)
+
+	return c.Status(fiber.StatusCreated).JSON(template)
+}
+
+// UpdatePromptTemplate saves a new version of a template. Earlier versions are kept.
+func UpdatePromptTemplate(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	var req PromptTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse prompt template request: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	latest, err := findPromptTemplate(name, 0)
+	if err != nil {
+		logger.Error("Prompt template not found: %v", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Prompt template not found",
+		})
+	}
+
+	currentUser := c.Locals("user").(models.AdminUser)
+	template := *latest
+	template.ID = uuid.Nil
+	template.Version = latest.Version + 1
+	template.CreatedByID = &currentUser.ID
+	template.CreatedAt = time.Time{}
+	req.apply(&template)
+
+	if err := template.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// The unique index on name and version rejects a concurrent update
+	if err := database.DB.Create(&template).Error; err != nil {
+		logger.Error("Failed to create prompt template version: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update prompt template",
+		})
+	}
+
+	logger.AdminAction(
+		currentUser.ID,
+		currentUser.Name,
+		"UPDATE_PROMPT_TEMPLATE",
+		fmt.Sprintf("Created version %d of prompt template: %s", template.Version, template.Name),
+	)
+
+	return c.JSON(template)
+}
+
+// GetPromptTemplates lists the latest version of every template
+func GetPromptTemplates(c *fiber.Ctx) error {
+	var templates []models.PromptTemplate
+	if err := database.DB.
+		Where("(name, version) IN (SELECT name, MAX(version) FROM prompt_templates GROUP BY name)").
+		Order("name").
+		Find(&templates).Error; err != nil {
+		logger.Error("Failed to get prompt templates: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get prompt templates",
+		})
+	}
+
+	return c.JSON(templates)
+}
+
+// GetPromptTemplate gets the latest version of a template
+func GetPromptTemplate(c *fiber.Ctx) error {
+	template, err := findPromptTemplate(c.Params("name"), 0)
+	if err != nil {
+		logger.Error("Prompt template not found: %v", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Prompt template not found",
+		})
+	}
+
+	return c.JSON(template)
+}
+
+// GetPromptTemplateVersions lists every version of a template, newest first
+func GetPromptTemplateVersions(c *fiber.Ctx) error {
+	var templates []models.PromptTemplate
+	if err := database.DB.Where("name = ?", c.Params("name")).
+		Order("version DESC").
+		Find(&templates).Error; err != nil {
+		logger.Error("Failed to get prompt template versions: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get prompt template versions",
+		})
+	}
+	if len(templates) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Prompt template not found",
+		})
+	}
+
+	return c.JSON(templates)
+}
+
+// GetPromptTemplateVersion gets one version of a template
+func GetPromptTemplateVersion(c *fiber.Ctx) error {
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil || version <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid version number",
+		})
+	}
+
+	template, err := findPromptTemplate(c.Params("name"), version)
+	if err != nil {
+		logger.Error("Prompt template version not found: %v", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Prompt template version not found",
+		})
+	}
+
+	return c.JSON(template)
+}
+
+// DeletePromptTemplate deletes a template with all of its versions
+func DeletePromptTemplate(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	result := database.DB.Where("name = ?", name).Delete(&models.PromptTemplate{})
+	if result.Error != nil {
+		logger.Error("Failed to delete prompt template: %v", result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete prompt template",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Prompt template not found",
+		})
+	}
+
+	currentUser := c.Locals("user").(models.AdminUser)
+	logger.AdminAction(
+		currentUser.ID,
+		currentUser.Name,
+		"DELETE_PROMPT_TEMPLATE",
+		"Deleted prompt template: "+name,
+	)
+
+	return c.JSON(fiber.Map{
+		"message": "Prompt template deleted successfully",
+	})
+}
+
+// templateValue formats a variable value for a prompt: strings as they are,
+// anything else as JSON
+func templateValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// templateContentValues reads the content.* variables from a published entry
+// the API user may read. Password fields are never exposed.
+func templateContentValues(apiUser models.APIUser, ref TemplateContentRef) (map[string]string, error) {
+	var schema models.Schema
+	if err := database.DB.Where("slug = ?", ref.Schema).First(&schema).Error; err != nil {
+		return nil, fmt.Errorf("schema '%s' not found", ref.Schema)
+	}
+	if !apiUser.HasScope(schema.Slug + ":read") {
+		return nil, fmt.Errorf("no read access to schema '%s'", schema.Slug)
+	}
+
+	var entry models.ContentEntry
+	if err := database.DB.
+		Where("content_type_id = ? AND slug = ? AND is_published = ?", schema.ID, ref.Slug, true).
+		First(&entry).Error; err != nil {
+		return nil, fmt.Errorf("content '%s' not found", ref.Slug)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(entry.Data, &data); err != nil {
+		return nil, fmt.Errorf("invalid content data: %v", err)
+	}
+	var fields []models.FieldDefinition
+	if err := json.Unmarshal(schema.Fields, &fields); err != nil {
+		return nil, fmt.Errorf("invalid schema fields: %v", err)
+	}
+
+	values := make(map[string]string)
+	for _, field := range fields {
+		if field.Type == models.FieldTypePassword {
+			continue
+		}
+		if value, exists := data[field.Name]; exists {
+			values[models.ContentVariablePrefix+field.Name] = templateValue(value)
+		}
+	}
+	values[models.ContentVariablePrefix+"slug"] = entry.Slug
+	return values, nil
+}
+
+// RunPromptTemplate fills the variables of a template and sends it to the LLM.
+// Variables named content.<field> are read from the referenced content entry.
+func RunPromptTemplate(c *fiber.Ctx) error {
+	apiUser, ok := c.Locals("user").(models.APIUser)
+	if !ok {
+		logger.Error("User is not an API user")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "User is not an API user",
+		})
+	}
+
+	var req RunPromptTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse prompt template run request: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	template, err := findPromptTemplate(c.Params("name"), req.Version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Prompt template not found",
+			})
+		}
+		logger.Error("Failed to get prompt template: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get prompt template",
+		})
+	}
+
+	values := make(map[string]string)
+	for name, value := range req.Variables {
+		if !strings.HasPrefix(name, models.ContentVariablePrefix) {
+			values[name] = templateValue(value)
+		}
+	}
+	if req.Content != nil {
+		contentValues, err := templateContentValues(apiUser, *req.Content)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		for name, value := range contentValues {
+			values[name] = value
+		}
+	}
+
+	system, body, missing := template.Render(values)
+	if len(missing) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Missing template variables",
+			"missing": missing,
+		})
+	}
+
+	llmReq := llm.LLMRequest{
+		Prompt:      body,
+		MaxTokens:   template.MaxTokens,
+		Temperature: template.Temperature,
+		TopP:        req.TopP,
+		Model:       template.Model,
+		Stream:      req.Stream,
+	}
+	if system != "" {
+		llmReq.Messages = []llm.Message{{Role: llm.RoleSystem, Content: system}}
+	}
+	if req.MaxTokens > 0 {
+		llmReq.MaxTokens = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		llmReq.Temperature = req.Temperature
+	}
+	if req.Model != "" {
+		llmReq.Model = req.Model
+	}
+
+	provider := meteredProvider(c)
+	if provider == nil {
+		logger.Error("LLM provider not initialized")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "LLM service not available",
+		})
+	}
+
+	if !req.Stream {
+		ctx, cancel := llmContext(config.AppConfig.LLM_CHAT_TIMEOUT)
+		defer cancel()
+
+		resp, err := provider.Chat(ctx, llmReq)
+		if err != nil {
+			logger.Error("LLM prompt template error: %v", err)
+			if errors.Is(err, llm.ErrUnavailable) {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"error": "LLM service temporarily unavailable",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get response from LLM",
+			})
+		}
+
+		return c.JSON(PromptTemplateRunResponse{
+			LLMResponse: *resp,
+			Template:    template.Name,
+			Version:     template.Version,
+		})
+	}
+
+	ctx, cancel := llmContext(config.AppConfig.LLM_STREAM_TIMEOUT)
+
+	stream, err := provider.ChatStream(ctx, llmReq)
+	if err != nil {
+		cancel()
+		logger.Error("LLM prompt template stream error: %v", err)
+		if errors.Is(err, llm.ErrUnavailable) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "LLM service temporarily unavailable",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get stream from LLM",
+		})
+	}
+
+	writeLLMStream(c, ctx, cancel, stream, func(resp llm.LLMStreamResponse) interface{} {
+		return PromptTemplateStreamResponse{
+			LLMStreamResponse: resp,
+			Template:          template.Name,
+			Version:           template.Version,
+		}
+	})
+	return nil
+}
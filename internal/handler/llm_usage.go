@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"contentive/internal/database"
+	"contentive/internal/llm"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// usageProvider records the tokens of every call made for an API user
+type usageProvider struct {
+	llm.LLMProvider
+	apiUser  models.APIUser
+	endpoint string
+}
+
+// meteredProvider returns the LLM provider. For API users it is wrapped so that
+// the usage of every call, tool rounds included, is recorded for the quotas.
+func meteredProvider(c *fiber.Ctx) llm.LLMProvider {
+	provider := llm.GetProvider()
+	apiUser, ok := c.Locals("user").(models.APIUser)
+	if provider == nil || !ok {
+		return provider
+	}
+
+	return &usageProvider{
+		LLMProvider: provider,
+		apiUser:     apiUser,
+		endpoint:    c.Route().Path,
+	}
+}
+
+// record stores the usage of a call. When the provider did not report it, the
+// usage is estimated from the request and the reply.
+func (p *usageProvider) record(req llm.LLMRequest, reply string, usage *llm.Usage, provider string) {
+	estimated := usage == nil
+	if estimated {
+		usage = llm.EstimateUsage(req, reply)
+	}
+
+	if err := database.DB.Create(&models.LLMUsage{
+		APIUserID:        p.apiUser.ID,
+		Endpoint:         p.endpoint,
+		Provider:         provider,
+		Model:            req.Model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+		Estimated:        estimated,
+	}).Error; err != nil {
+		logger.Error("Failed to record LLM usage of API user %s: %v", p.apiUser.Name, err)
+	}
+}
+
+// Chat sends the request and records its usage
+func (p *usageProvider) Chat(ctx context.Context, req llm.LLMRequest) (*llm.LLMResponse, error) {
+	resp, err := p.LLMProvider.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	p.record(req, resp.Text, resp.Usage, resp.Provider)
+	return resp, nil
+}
+
+// ChatStream relays the stream and records its usage when it ends, also when
+// the client goes away before the reply is complete
+func (p *usageProvider) ChatStream(ctx context.Context, req llm.LLMRequest) (<-chan llm.LLMStreamResponse, error) {
+	stream, err := p.LLMProvider.ChatStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	responseChan := make(chan llm.LLMStreamResponse)
+
+	go func() {
+		defer close(responseChan)
+
+		var reply strings.Builder
+		var usage *llm.Usage
+		var provider string
+		defer func() {
+			p.record(req, reply.String(), usage, provider)
+		}()
+
+		for resp := range stream {
+			reply.WriteString(resp.Text)
+			if resp.Usage != nil {
+				usage = resp.Usage
+			}
+			provider = resp.Provider
+
+			select {
+			case <-ctx.Done():
+				return
+			case responseChan <- resp:
+			}
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// LLMUsageTotals sums the usage of a period or an endpoint
+type LLMUsageTotals struct {
+	Requests         int64 `json:"requests"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// LLMUsagePeriod is the usage of one day or month
+type LLMUsagePeriod struct {
+	Period time.Time `json:"period"`
+	LLMUsageTotals
+}
+
+// LLMUsageEndpoint is the usage of one endpoint
+type LLMUsageEndpoint struct {
+	Endpoint string `json:"endpoint"`
+	LLMUsageTotals
+}
+
+// LLMUsageQuery represents the query parameters for the GetAPIUserUsage handler
+type LLMUsageQuery struct {
+	From    string `query:"from"`     // first day, YYYY-MM-DD
+	To      string `query:"to"`       // last day, YYYY-MM-DD
+	GroupBy string `query:"group_by"` // day or month
+}
+
+const usageTotalsSelect = "COUNT(*) AS requests, " +
+	"COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, " +
+	"COALESCE(SUM(completion_tokens), 0) AS completion_tokens, " +
+	"COALESCE(SUM(total_tokens), 0) AS total_tokens"
+
+// GetAPIUserUsage reports the LLM token usage of an API user per day or month
+// and per endpoint, together with the quotas and the usage counted against them. Days are
+// UTC days, like the quotas.
+func GetAPIUserUsage(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var apiUser models.APIUser
+	if err := database.DB.Where("id = ?", id).First(&apiUser).Error; err != nil {
+		logger.Error("Failed to get API user: %v", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "API user not found",
+		})
+	}
+
+	query := new(LLMUsageQuery)
+	if err := c.QueryParser(query); err != nil {
+		logger.Error("Error parsing query parameters: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid query parameters",
+		})
+	}
+
+	if query.GroupBy == "" {
+		query.GroupBy = "day"
+	}
+	if query.GroupBy != "day" && query.GroupBy != "month" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "group_by must be day or month",
+		})
+	}
+
+	now := time.Now().UTC()
+	to := models.StartOfDay(now)
+	if query.To != "" {
+		parsed, err := time.Parse(time.DateOnly, query.To)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "to must be a date in YYYY-MM-DD format",
+			})
+		}
+		to = parsed
+	}
+
+	// Default to the last 30 days, or the last 12 months
+	from := to.AddDate(0, 0, -29)
+	if query.GroupBy == "month" {
+		from = models.StartOfMonth(to).AddDate(0, -11, 0)
+	}
+	if query.From != "" {
+		parsed, err := time.Parse(time.DateOnly, query.From)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "from must be a date in YYYY-MM-DD format",
+			})
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "from must not be after to",
+		})
+	}
+
+	// to is inclusive
+	db := database.DB.Model(&models.LLMUsage{}).
+		Where("api_user_id = ? AND created_at >= ? AND created_at < ?", apiUser.ID, from, to.AddDate(0, 0, 1))
+
+	var totals LLMUsageTotals
+	if err := db.Session(&gorm.Session{}).Select(usageTotalsSelect).Scan(&totals).Error; err != nil {
+		logger.Error("Failed to get LLM usage: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get usage",
+		})
+	}
+
+	periods := []LLMUsagePeriod{}
+	if err := db.Session(&gorm.Session{}).
+		Select("date_trunc(?, created_at AT TIME ZONE 'UTC') AS period, "+usageTotalsSelect, query.GroupBy).
+		Group("period").
+		Order("period").
+		Scan(&periods).Error; err != nil {
+		logger.Error("Failed to get LLM usage per %s: %v", query.GroupBy, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get usage",
+		})
+	}
+
+	endpoints := []LLMUsageEndpoint{}
+	if err := db.Session(&gorm.Session{}).
+		Select("endpoint, " + usageTotalsSelect).
+		Group("endpoint").
+		Order("total_tokens DESC").
+		Scan(&endpoints).Error; err != nil {
+		logger.Error("Failed to get LLM usage per endpoint: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get usage",
+		})
+	}
+
+	usedToday, err := models.SumLLMTokens(database.DB, apiUser.ID, models.StartOfDay(now))
+	if err != nil {
+		logger.Error("Failed to get LLM usage: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get usage",
+		})
+	}
+	usedThisMonth, err := models.SumLLMTokens(database.DB, apiUser.ID, models.StartOfMonth(now))
+	if err != nil {
+		logger.Error("Failed to get LLM usage: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get usage",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"api_user_id": apiUser.ID,
+		"from":        from.Format(time.DateOnly),
+		"to":          to.Format(time.DateOnly),
+		"group_by":    query.GroupBy,
+		"quota": fiber.Map{
+			"daily":           apiUser.DailyTokenQuota,
+			"monthly":         apiUser.MonthlyTokenQuota,
+			"used_today":      usedToday,
+			"used_this_month": usedThisMonth,
+		},
+		"totals":    totals,
+		"periods":   periods,
+		"endpoints": endpoints,
+	})
+}
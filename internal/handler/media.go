@@ -7,10 +7,13 @@ import (
 	"contentive/internal/storage"
 	"fmt"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type MediaQuery struct {
@@ -18,6 +21,14 @@ type MediaQuery struct {
 	PageSize int    `query:"page_size"`
 	Type     string `query:"type"`
 	Search   string `query:"search"`
+	Cursor   string `query:"cursor"` // keyset cursor, an empty cursor starts at the first page
+	Count    string `query:"count"`  // whether to count the media, true by default for pages and false for cursors
+}
+
+// mediaSortKeys is the order of media listings, newest first
+var mediaSortKeys = []sortKey{
+	{Expression: "created_at", Type: "timestamptz", Desc: true},
+	{Expression: "id", Type: "uuid", Desc: true},
 }
 
 func UploadMedia(c *fiber.Ctx) error {
@@ -125,10 +136,60 @@ func GetMedia(c *fiber.Ctx) error {
 	return c.JSON(media)
 }
 
+// GetMediaUsages lists the entries that use a media in their media and media
+// list fields
+func GetMediaUsages(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var media models.Media
+	if err := database.DB.First(&media, "id = ?", id).Error; err != nil {
+		logger.Error("Media not found: %v", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Media not found",
+		})
+	}
+
+	usages, err := models.MediaUsages(database.DB, media.ID)
+	if err != nil {
+		logger.Error("Failed to find usages of media: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find usages",
+		})
+	}
+	if usages == nil {
+		usages = []models.Reference{}
+	}
+
+	return c.JSON(fiber.Map{
+		"media_id": media.ID,
+		"usages":   usages,
+		"total":    len(usages),
+	})
+}
+
 func DeleteMedia(c *fiber.Ctx) error {
-	currentUser := c.Locals("user").(models.AdminUser)
+	currentUser := c.Locals("user")
 	id := c.Params("id")
 
+	// The media API deletes media too
+	var userType models.ContentEntryUserByType
+	var userID uuid.UUID
+	var userName string
+	if adminUser, ok := currentUser.(models.AdminUser); ok {
+		userType = models.ContentEntryUserByTypeAdmin
+		userID = adminUser.ID
+		userName = adminUser.Name
+	} else if apiUser, ok := currentUser.(models.APIUser); ok {
+		userType = models.ContentEntryUserByTypeAPI
+		userID = apiUser.ID
+		userName = apiUser.Name
+	} else {
+		logger.Error("Invalid user type")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user type",
+		})
+	}
+
 	var media models.Media
 	if err := database.DB.First(&media, "id = ?", id).Error; err != nil {
 		logger.Error("Media not found: %v", err)
@@ -137,22 +198,79 @@ func DeleteMedia(c *fiber.Ctx) error {
 		})
 	}
 
+	tx := database.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("Failed to start transaction: %v", tx.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Apply the onDelete policies of the fields referring to the media
+	plan, err := models.PlanMediaDelete(tx, media.ID)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("Failed to find references to media: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete media record",
+		})
+	}
+	if len(plan.Restrict) > 0 {
+		tx.Rollback()
+		logger.Warning("Media %s is referenced by %d entries, not deleted", media.Name, len(plan.Restrict))
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":      "Media is referenced by content entries",
+			"references": plan.Restrict,
+		})
+	}
+	if missing := missingDeleteScopes(currentUser, plan); len(missing) > 0 {
+		tx.Rollback()
+		logger.Warning("Media %s not deleted, the API user lacks %v for the entries referring to it", media.Name, missing)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":          "Insufficient permissions for the entries the delete changes",
+			"missing_scopes": missing,
+		})
+	}
+	if err := plan.Apply(tx, userType, userID); err != nil {
+		tx.Rollback()
+		logger.Error("Failed to apply media delete to content: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete media record",
+		})
+	}
+
+	if err := tx.Delete(&media).Error; err != nil {
+		tx.Rollback()
+		logger.Error("Failed to delete media record: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete media record",
+		})
+	}
+
+	// The file goes last, so a failure leaves the media and content as they were
 	storageProvider := storage.GetStorageProvider()
 	if err := storageProvider.Delete(media.Path); err != nil {
+		tx.Rollback()
 		logger.Error("Failed to delete file: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete file",
 		})
 	}
 
-	if err := database.DB.Delete(&media).Error; err != nil {
-		logger.Error("Failed to delete media record: %v", err)
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("Failed to commit transaction: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete media record",
 		})
 	}
 
-	logger.AdminAction(currentUser.ID, currentUser.Name, "DELETE_MEDIA", "Deleted media: "+media.Name)
+	enqueueDeletePlan(plan)
+
+	if userType == models.ContentEntryUserByTypeAdmin {
+		logger.AdminAction(userID, userName, "DELETE_MEDIA", "Deleted media: "+media.Name+deletePlanSummary(plan))
+	} else {
+		logger.APIAction(userID, userName, "DELETE_MEDIA", "Deleted media: "+media.Name+deletePlanSummary(plan))
+	}
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
@@ -186,28 +304,104 @@ func ListMedia(c *fiber.Ctx) error {
 		db = db.Where("type = ?", query.Type)
 	}
 
-	if err := db.Count(&total).Error; err != nil {
-		logger.Error("Failed to count media: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to count media",
+	// A cursor parameter, even an empty one, switches to keyset pagination
+	useCursor := c.Context().QueryArgs().Has("cursor")
+	var cursor *pageCursor
+	if query.Cursor != "" {
+		var err error
+		cursor, err = decodeCursor(query.Cursor, mediaSortKeys)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	count := !useCursor
+	if query.Count != "" {
+		var err error
+		count, err = strconv.ParseBool(query.Count)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "count must be true or false",
+			})
+		}
+	}
+
+	if count {
+		if err := db.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			logger.Error("Failed to count media: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to count media",
+			})
+		}
+	}
+
+	if useCursor {
+		if err := keysetPage(db, mediaSortKeys, cursor, query.PageSize).Find(&media).Error; err != nil {
+			logger.Error("Failed to fetch media: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch media",
+			})
+		}
+
+		hasMore := len(media) > query.PageSize
+		if hasMore {
+			media = media[:query.PageSize]
+		}
+		if cursor != nil && cursor.Before {
+			slices.Reverse(media)
+		}
+
+		meta := fiber.Map{
+			"page_size":   query.PageSize,
+			"next_cursor": nil,
+			"prev_cursor": nil,
+		}
+		if len(media) > 0 {
+			next, prev, err := keysetCursors(database.DB, &models.Media{}, mediaSortKeys, cursor, hasMore, media[0].ID, media[len(media)-1].ID)
+			if err != nil {
+				logger.Error("Failed to build media cursors: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to fetch media",
+				})
+			}
+			if next != "" {
+				meta["next_cursor"] = next
+			}
+			if prev != "" {
+				meta["prev_cursor"] = prev
+			}
+		}
+		if count {
+			meta["total"] = total
+		}
+
+		return c.JSON(fiber.Map{
+			"data": media,
+			"meta": meta,
 		})
 	}
 
 	offset := (query.Page - 1) * query.PageSize
-	if err := db.Offset(offset).Limit(query.PageSize).Find(&media).Error; err != nil {
+	if err := db.Order(orderClause(mediaSortKeys, false)).Offset(offset).Limit(query.PageSize).Find(&media).Error; err != nil {
 		logger.Error("Failed to fetch media: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch media",
 		})
 	}
 
+	meta := fiber.Map{
+		"page":      query.Page,
+		"page_size": query.PageSize,
+	}
+	if count {
+		meta["total"] = total
+	}
+
 	return c.JSON(fiber.Map{
 		"data": media,
-		"meta": fiber.Map{
-			"total":     total,
-			"page":      query.Page,
-			"page_size": query.PageSize,
-		},
+		"meta": meta,
 	})
 }
 
@@ -4,7 +4,9 @@ import (
 	"contentive/internal/database"
 	"contentive/internal/logger"
 	"contentive/internal/models"
+	"contentive/internal/rag"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -98,6 +100,8 @@ func CreateSchema(c *fiber.Ctx) error {
 		})
 	}
 
+	syncSortIndexes(schema.ID)
+
 	currentUser := c.Locals("user").(models.AdminUser)
 	logger.AdminAction(
 		currentUser.ID,
@@ -109,6 +113,41 @@ func CreateSchema(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusCreated).JSON(schema)
 }
 
+// syncSortIndexes updates the sort indexes of a schema in the background,
+// since building an index on a large schema takes a while. The fields are
+// read when the sync runs, so the last sync of quick successive updates builds
+// the indexes of the latest fields, and those of a deleted schema are dropped.
+// The syncs of a schema run one at a time, across instances too.
+func syncSortIndexes(schemaID uuid.UUID) {
+	go func() {
+		unlock, err := models.LockSortIndexes(database.DB, schemaID)
+		if err != nil {
+			logger.Error("Failed to lock the sort indexes of schema %s: %v", schemaID, err)
+			return
+		}
+		defer unlock()
+
+		var fields []models.FieldDefinition
+		var schema models.Schema
+		err = database.DB.First(&schema, "id = ?", schemaID).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+		case err != nil:
+			logger.Error("Failed to load schema %s for its sort indexes: %v", schemaID, err)
+			return
+		default:
+			if err := json.Unmarshal(schema.Fields, &fields); err != nil {
+				logger.Error("Failed to parse the fields of schema %s: %v", schemaID, err)
+				return
+			}
+		}
+
+		if err := models.SyncSortIndexes(database.DB, schemaID, fields); err != nil {
+			logger.Error("Failed to update the sort indexes of schema %s: %v", schemaID, err)
+		}
+	}()
+}
+
 func isValidSlug(slug string) bool {
 	return slug == strings.ToLower(slug) &&
 		!strings.Contains(slug, " ") &&
@@ -279,6 +318,10 @@ func UpdateSchema(c *fiber.Ctx) error {
 		// Handle field changes
 		if err := handleFieldChanges(tx, schema.ID, existingFields, *input.Fields); err != nil {
 			tx.Rollback()
+			var conflict *models.RelationConflictError
+			if errors.As(err, &conflict) {
+				return relationErrorResponse(c, err)
+			}
 			logger.Error("Error handling field changes: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Internal server error",
@@ -301,6 +344,12 @@ func UpdateSchema(c *fiber.Ctx) error {
 				"error": "Internal server error",
 			})
 		}
+
+		// Field changes may change what is indexed for the schema's content
+		if _, err := rag.EnqueueSchema(schema.ID, false); err != nil {
+			logger.Error("Failed to queue schema content for indexing: %v", err)
+		}
+		syncSortIndexes(schema.ID)
 	} else {
 		// Save schema directly if no field updates
 		if err := database.DB.Save(&schema).Error; err != nil {
@@ -359,6 +408,15 @@ func DeleteSchema(c *fiber.Ctx) error {
 		})
 	}
 
+	// Delete the links from and to the content entries of the schema.
+	if err := tx.Where("source_schema_id = ? OR target_schema_id = ?", schema.ID, schema.ID).Delete(&models.ContentRelation{}).Error; err != nil {
+		tx.Rollback()
+		logger.Error("Failed to delete content relations: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete content entries",
+		})
+	}
+
 	// Delete the schema itself.
 	if err := tx.Delete(&schema).Error; err != nil {
 		tx.Rollback()
@@ -376,6 +434,12 @@ func DeleteSchema(c *fiber.Ctx) error {
 		})
 	}
 
+	// Drop the deleted content from the knowledge index
+	if _, err := rag.EnqueueSchema(schema.ID, false); err != nil {
+		logger.Error("Failed to queue schema content for indexing: %v", err)
+	}
+	syncSortIndexes(schema.ID)
+
 	// Log the admin action.
 	currentUser := c.Locals("user").(models.AdminUser)
 	logger.AdminAction(
@@ -480,6 +544,13 @@ func handleFieldChanges(tx *gorm.DB, schemaID uuid.UUID, oldFields, newFields []
 			return fmt.Errorf("failed to update content entries: %v", err)
 		}
 
+		// Removed and renamed fields change the links of the entries
+		for i := range contents {
+			if err := models.SyncRelations(tx, contents[i], newFields); err != nil {
+				return fmt.Errorf("failed to update relations of content '%s': %w", contents[i].Slug, err)
+			}
+		}
+
 		offset += batchSize
 	}
 
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"contentive/internal/config"
+	"contentive/internal/database"
+	"contentive/internal/llm"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// maxSchemaGenerateAttempts allows one retry when the generated schema is invalid
+const maxSchemaGenerateAttempts = 2
+
+// GenerateSchemaRequest is the request to draft a schema from a description
+type GenerateSchemaRequest struct {
+	Description string `json:"description"`
+	Model       string `json:"model,omitempty"`
+}
+
+// SchemaDraft is a generated schema that has not been saved
+type SchemaDraft struct {
+	Name   string                   `json:"name"`
+	Type   models.SchemaType        `json:"type"`
+	Slug   string                   `json:"slug"`
+	Fields []models.FieldDefinition `json:"fields"`
+}
+
+const schemaGeneratePrompt = `You design content types for a headless CMS.
+Reply with one JSON object of the form:
+{"name": "Product", "slug": "product", "type": "list", "fields": [{"name": "title", "type": "text", "required": true, "options": {"maxLength": 100}}]}
+
+Rules:
+- "slug" is lowercase, without spaces or underscores, for example "blog-post"
+- "type" is "list" for collections of entries or "single" for a single page
+- field names are unique camelCase identifiers and must not be "media" or "media_list"
+- field types and their options:
+  - text, textarea: optional "maxLength" (positive integer) and "minLength" (non-negative integer, not greater than maxLength)
+  - richtext: formatted long text
+  - number: optional "min", "max" and "precision" (non-negative integer)
+  - date, datetime: optional "format" (non-empty string)
+  - boolean: optional "default" (true or false)
+  - select: required "choices" (non-empty array of strings), optional "default" that is one of the choices
+  - email, password: no default for password
+  - media: a single image or file, optional "allowedTypes" (array of MIME types) and "maxSize" (bytes)
+  - media_list: several images or files, same options as media
+  - relation: required "targetSchema" (slug of an existing schema) and "relationType" (one of "one-to-one", "one-to-many", "many-to-one", "many-to-many")
+`
+
+// GenerateSchema asks the LLM for a schema matching a description. The draft is
+// validated like a new schema but not saved, so it can be reviewed first.
+func GenerateSchema(c *fiber.Ctx) error {
+	var req GenerateSchemaRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse generate schema request: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	req.Description = strings.TrimSpace(req.Description)
+	if req.Description == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Description is required",
+		})
+	}
+
+	provider := llm.GetProvider()
+	if provider == nil {
+		logger.Error("LLM provider not initialized")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "LLM service not available",
+		})
+	}
+
+	// Existing schemas are the only valid relation targets
+	var existing []models.Schema
+	if err := database.DB.Select("name", "slug").Order("slug").Find(&existing).Error; err != nil {
+		logger.Error("Failed to fetch schemas: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch schemas",
+		})
+	}
+
+	var prompt strings.Builder
+	if len(existing) > 0 {
+		prompt.WriteString("Existing schemas, usable as relation targets. Do not reuse their name or slug:\n")
+		for _, schema := range existing {
+			fmt.Fprintf(&prompt, "- %s (slug: %s)\n", schema.Name, schema.Slug)
+		}
+	} else {
+		prompt.WriteString("There are no existing schemas, so do not use relation fields.\n")
+	}
+	fmt.Fprintf(&prompt, "\nDescription: %s", req.Description)
+
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: schemaGeneratePrompt},
+		{Role: llm.RoleUser, Content: prompt.String()},
+	}
+
+	ctx, cancel := llmContext(config.AppConfig.LLM_GENERATE_TIMEOUT)
+	defer cancel()
+
+	var draft *SchemaDraft
+	var validationErr error
+	attempts := 0
+	for attempts < maxSchemaGenerateAttempts {
+		attempts++
+
+		resp, err := provider.Chat(ctx, llm.LLMRequest{
+			Messages: messages,
+			Model:    req.Model,
+			Format:   &llm.ResponseFormat{Type: llm.ResponseFormatJSONObject},
+		})
+		if err != nil {
+			logger.Error("LLM generate schema error: %v", err)
+			if errors.Is(err, llm.ErrUnavailable) {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"error": "LLM service temporarily unavailable",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get response from LLM",
+			})
+		}
+
+		draft, validationErr = parseSchemaDraft(resp.Text)
+		if validationErr == nil {
+			break
+		}
+
+		messages = append(messages,
+			llm.Message{Role: llm.RoleAssistant, Content: resp.Text},
+			llm.Message{Role: llm.RoleUser, Content: fmt.Sprintf("That schema is invalid: %v. Reply with the corrected JSON object only.", validationErr)},
+		)
+	}
+
+	if validationErr != nil {
+		logger.Error("Generated schema is invalid: %v", validationErr)
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to generate a valid schema: %v", validationErr),
+		})
+	}
+
+	currentUser := c.Locals("user").(models.AdminUser)
+	logger.AdminAction(
+		currentUser.ID,
+		currentUser.Name,
+		"GENERATE_SCHEMA",
+		"Generated schema draft: "+draft.Name,
+	)
+
+	return c.JSON(fiber.Map{
+		"draft":    draft,
+		"attempts": attempts,
+	})
+}
+
+// parseSchemaDraft decodes the LLM output and checks it the way CreateSchema would
+func parseSchemaDraft(text string) (*SchemaDraft, error) {
+	text = strings.TrimSpace(text)
+	if m := codeFenceRegex.FindStringSubmatch(text); m != nil {
+		text = m[1]
+	}
+
+	var draft SchemaDraft
+	if err := json.Unmarshal([]byte(text), &draft); err != nil {
+		return nil, fmt.Errorf("not a valid JSON object: %v", err)
+	}
+
+	if draft.Name == "" || draft.Type == "" || draft.Slug == "" {
+		return nil, errors.New("name, type and slug are required")
+	}
+	if draft.Type != models.SchemaTypeList && draft.Type != models.SchemaTypeSingle {
+		return nil, errors.New("type must be list or single")
+	}
+	if !isValidSlug(draft.Slug) {
+		return nil, errors.New("slug must be lowercase, without spaces or underscores")
+	}
+	if len(draft.Fields) == 0 {
+		return nil, errors.New("at least one field is required")
+	}
+
+	var existingSchema models.Schema
+	if err := database.DB.Where("slug = ? OR name = ?", draft.Slug, draft.Name).First(&existingSchema).Error; err == nil {
+		return nil, fmt.Errorf("a schema named '%s' or with slug '%s' already exists", draft.Name, draft.Slug)
+	}
+
+	for i := range draft.Fields {
+		draft.Fields[i].ID = uuid.New()
+	}
+
+	fieldsJSON, err := json.Marshal(draft.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fields: %v", err)
+	}
+	schema := models.Schema{
+		Name:   draft.Name,
+		Type:   draft.Type,
+		Slug:   draft.Slug,
+		Fields: datatypes.JSON(fieldsJSON),
+	}
+	if err := schema.ValidateFields(); err != nil {
+		return nil, err
+	}
+
+	return &draft, nil
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"contentive/internal/config"
+	"contentive/internal/database"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"contentive/internal/rag"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// searchTimeout bounds the time spent embedding the query and ranking entries
+const searchTimeout = 30 * time.Second
+
+// SearchQuery represents the query parameters for the SearchContent handler
+type SearchQuery struct {
+	Query    string   `query:"q"`         // search text
+	Alpha    *float64 `query:"alpha"`     // 0 ranks by full-text only, 1 by semantic similarity only
+	Page     int      `query:"page"`      // page number
+	PageSize int      `query:"page_size"` // results per page
+	Status   string   `query:"status"`    // published or draft, admin only
+}
+
+// SearchContent ranks the content entries of a schema by a blend of full-text
+// and semantic relevance. API users only see published entries.
+func SearchContent(c *fiber.Ctx) error {
+	var schemaID interface{}
+	if id := c.Locals("schema_id"); id != nil {
+		schemaID = id
+	} else {
+		schemaID = c.Params("schema_id")
+	}
+
+	query := new(SearchQuery)
+	if err := c.QueryParser(query); err != nil {
+		logger.Error("Error parsing query parameters: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid query parameters",
+		})
+	}
+
+	query.Query = strings.TrimSpace(query.Query)
+	if query.Query == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Search query is required",
+		})
+	}
+
+	alpha := config.AppConfig.SEARCH_ALPHA
+	if query.Alpha != nil {
+		alpha = *query.Alpha
+	}
+	if alpha < 0 || alpha > 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "alpha must be between 0 and 1",
+		})
+	}
+
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.PageSize <= 0 {
+		query.PageSize = 10
+	} else if query.PageSize > 100 {
+		query.PageSize = 100
+	}
+
+	_, isAPIUser := c.Locals("user").(models.APIUser)
+	if query.Status != "" {
+		if isAPIUser || (query.Status != "published" && query.Status != "draft") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid status parameter",
+			})
+		}
+	}
+
+	var schema models.Schema
+	if err := database.DB.Where("id = ?", schemaID).First(&schema).Error; err != nil {
+		logger.Error("Schema not found: %v", err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Schema not found",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), searchTimeout)
+	defer cancel()
+
+	result, err := rag.HybridSearch(ctx, rag.SearchQuery{
+		Schema:        schema,
+		Query:         query.Query,
+		Alpha:         alpha,
+		PublishedOnly: isAPIUser,
+		Status:        query.Status,
+		Limit:         query.PageSize,
+		Offset:        (query.Page - 1) * query.PageSize,
+	})
+	if err != nil {
+		logger.Error("Failed to search content: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to search content",
+		})
+	}
+
+	totalPages := (result.Total + int64(query.PageSize) - 1) / int64(query.PageSize)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": result.Results,
+		"pagination": fiber.Map{
+			"current_page": query.Page,
+			"page_size":    query.PageSize,
+			"total_pages":  totalPages,
+			"total":        result.Total,
+		},
+		"query": fiber.Map{
+			"q":        query.Query,
+			"alpha":    result.Alpha,
+			"semantic": result.Semantic,
+			"status":   query.Status,
+		},
+	})
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"contentive/internal/llm"
+	"contentive/internal/logger"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Cache results reported in LLMResponse.Cache
+const (
+	StatusHit    = "hit"
+	StatusMiss   = "miss"
+	StatusBypass = "bypass"
+)
+
+// Store keeps cached responses until they expire
+type Store interface {
+	// Get returns the response stored under key, if there is one that has not expired
+	Get(ctx context.Context, key string) (*llm.LLMResponse, bool, error)
+	// Set stores a response under key for ttl
+	Set(ctx context.Context, key string, resp *llm.LLMResponse, ttl time.Duration) error
+}
+
+// CachedProvider is an LLMProvider that answers repeated deterministic
+// requests from a store. Only requests that set temperature 0 and have no
+// tools are cached, and streams are never cached.
+type CachedProvider struct {
+	llm.LLMProvider
+	store Store
+	ttl   time.Duration
+}
+
+// New wraps a provider with a cache
+func New(p llm.LLMProvider, store Store, ttl time.Duration) *CachedProvider {
+	return &CachedProvider{LLMProvider: p, store: store, ttl: ttl}
+}
+
+// cacheable reports whether the response to a request can be reused. A
+// request without a temperature is sampled at the provider's default, so it
+// is not deterministic.
+func cacheable(req llm.LLMRequest) bool {
+	return !req.NoCache && req.Temperature != nil && *req.Temperature == 0 && len(req.Tools) == 0
+}
+
+// Key hashes the parts of a request that determine the response. Whitespace
+// around message contents is ignored and the prompt is treated as the user
+// message it stands for.
+func Key(req llm.LLMRequest) string {
+	type keyMessage struct {
+		Role       string         `json:"role"`
+		Content    string         `json:"content"`
+		ToolCalls  []llm.ToolCall `json:"tool_calls,omitempty"`
+		ToolCallID string         `json:"tool_call_id,omitempty"`
+	}
+	normalized := struct {
+		Model     string              `json:"model"`
+		Messages  []keyMessage        `json:"messages"`
+		MaxTokens int                 `json:"max_tokens"`
+		TopP      float64             `json:"top_p"`
+		Format    *llm.ResponseFormat `json:"format,omitempty"`
+	}{
+		Model:     req.Model,
+		MaxTokens: req.MaxTokens,
+		TopP:      req.TopP,
+		Format:    req.Format,
+	}
+	for _, message := range req.ChatMessages() {
+		normalized.Messages = append(normalized.Messages, keyMessage{
+			Role:       message.Role,
+			Content:    strings.TrimSpace(message.Content),
+			ToolCalls:  message.ToolCalls,
+			ToolCallID: message.ToolCallID,
+		})
+	}
+
+	data, _ := json.Marshal(normalized)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Chat answers from the cache when possible. A cached answer consumed no tokens,
+// so it is returned with empty usage.
+func (p *CachedProvider) Chat(ctx context.Context, req llm.LLMRequest) (*llm.LLMResponse, error) {
+	if !cacheable(req) {
+		resp, err := p.LLMProvider.Chat(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Cache = StatusBypass
+		return resp, nil
+	}
+
+	key := Key(req)
+	cached, found, err := p.store.Get(ctx, key)
+	if err != nil {
+		// A broken cache must not break the request
+		logger.Error("Failed to read LLM cache: %v", err)
+	} else if found {
+		cached.Usage = &llm.Usage{}
+		cached.Cache = StatusHit
+		return cached, nil
+	}
+
+	resp, err := p.LLMProvider.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cut off answers are not worth keeping
+	if resp.FinishReason != "length" {
+		if err := p.store.Set(ctx, key, resp, p.ttl); err != nil {
+			logger.Error("Failed to write LLM cache: %v", err)
+		}
+	}
+	resp.Cache = StatusMiss
+	return resp, nil
+}
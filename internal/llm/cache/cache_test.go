@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"contentive/internal/llm"
+	"context"
+	"testing"
+	"time"
+)
+
+func temperature(v float64) *float64 {
+	return &v
+}
+
+func TestCacheable(t *testing.T) {
+	tests := []struct {
+		name string
+		req  llm.LLMRequest
+		want bool
+	}{
+		{"temperature unset", llm.LLMRequest{Prompt: "hi"}, false},
+		{"temperature 0", llm.LLMRequest{Prompt: "hi", Temperature: temperature(0)}, true},
+		{"temperature 0.7", llm.LLMRequest{Prompt: "hi", Temperature: temperature(0.7)}, false},
+		{"no cache", llm.LLMRequest{Prompt: "hi", Temperature: temperature(0), NoCache: true}, false},
+		{"tools", llm.LLMRequest{Prompt: "hi", Temperature: temperature(0), Tools: []llm.Tool{{Name: "search"}}}, false},
+	}
+
+	for _, tt := range tests {
+		if got := cacheable(tt.req); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// countingProvider answers every chat with the number of calls so far
+type countingProvider struct {
+	llm.LLMProvider
+	calls int
+}
+
+func (p *countingProvider) Chat(ctx context.Context, req llm.LLMRequest) (*llm.LLMResponse, error) {
+	p.calls++
+	return &llm.LLMResponse{Text: string(rune('0' + p.calls)), FinishReason: "stop"}, nil
+}
+
+func TestChatCachesOnlyExplicitTemperatureZero(t *testing.T) {
+	p := &countingProvider{}
+	cached := New(p, NewMemoryStore(10), time.Minute)
+	ctx := context.Background()
+
+	// Unset temperature is sampled by the provider, so every call gets a new answer
+	for i := 0; i < 2; i++ {
+		resp, err := cached.Chat(ctx, llm.LLMRequest{Prompt: "generate a title"})
+		if err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+		if resp.Cache != StatusBypass {
+			t.Errorf("unset temperature: got cache %q, want bypass", resp.Cache)
+		}
+	}
+	if p.calls != 2 {
+		t.Fatalf("got %d provider calls, want 2", p.calls)
+	}
+
+	req := llm.LLMRequest{Prompt: "summarize", Temperature: temperature(0)}
+	first, err := cached.Chat(ctx, req)
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	second, err := cached.Chat(ctx, req)
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if first.Cache != StatusMiss || second.Cache != StatusHit || second.Text != first.Text {
+		t.Errorf("got %q (%s) then %q (%s), want a miss then the same text from the cache",
+			first.Text, first.Cache, second.Text, second.Cache)
+	}
+	if p.calls != 3 {
+		t.Errorf("got %d provider calls, want 3", p.calls)
+	}
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"container/list"
+	"contentive/internal/llm"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory LRU store. It is lost on restart and not shared
+// between instances.
+type MemoryStore struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List // most recently used first
+}
+
+type memoryEntry struct {
+	key       string
+	resp      llm.LLMResponse
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates a store holding at most size responses
+func NewMemoryStore(size int) *MemoryStore {
+	if size <= 0 {
+		size = 1000
+	}
+	return &MemoryStore{
+		size:  size,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Get returns a copy of the response stored under key
+func (s *MemoryStore) Get(ctx context.Context, key string) (*llm.LLMResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, exists := s.items[key]
+	if !exists {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryEntry)
+	if time.Now().After(entry.expiresAt) {
+		s.order.Remove(element)
+		delete(s.items, key)
+		return nil, false, nil
+	}
+
+	s.order.MoveToFront(element)
+	resp := entry.resp
+	return &resp, true, nil
+}
+
+// Set stores a copy of the response, evicting the least recently used one when full
+func (s *MemoryStore) Set(ctx context.Context, key string, resp *llm.LLMResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &memoryEntry{key: key, resp: *resp, expiresAt: time.Now().Add(ttl)}
+	if element, exists := s.items[key]; exists {
+		element.Value = entry
+		s.order.MoveToFront(element)
+		return nil
+	}
+
+	s.items[key] = s.order.PushFront(entry)
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"contentive/internal/llm"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// pruneInterval is how often expired entries are removed from the table
+const pruneInterval = time.Minute
+
+// PostgresStore keeps responses in the llm_cache_entries table, so the cache
+// survives restarts and is shared between instances
+type PostgresStore struct {
+	db *gorm.DB
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+// NewPostgresStore creates a store on the given database
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Get returns the response stored under key if it has not expired
+func (s *PostgresStore) Get(ctx context.Context, key string) (*llm.LLMResponse, bool, error) {
+	var entry models.LLMCacheEntry
+	if err := s.db.WithContext(ctx).
+		Where("key = ? AND expires_at > ?", key, time.Now()).
+		First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var resp llm.LLMResponse
+	if err := json.Unmarshal(entry.Response, &resp); err != nil {
+		return nil, false, err
+	}
+	return &resp, true, nil
+}
+
+// Set stores the response, replacing an earlier one with the same key
+func (s *PostgresStore) Set(ctx context.Context, key string, resp *llm.LLMResponse, ttl time.Duration) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	entry := models.LLMCacheEntry{
+		Key:       key,
+		Response:  data,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"response", "expires_at", "created_at"}),
+	}).Create(&entry).Error; err != nil {
+		return err
+	}
+
+	s.prune()
+	return nil
+}
+
+// prune removes expired entries, at most once per pruneInterval
+func (s *PostgresStore) prune() {
+	s.mu.Lock()
+	if time.Since(s.lastPruned) < pruneInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPruned = time.Now()
+	s.mu.Unlock()
+
+	if err := s.db.Where("expires_at <= ?", time.Now()).Delete(&models.LLMCacheEntry{}).Error; err != nil {
+		logger.Error("Failed to prune LLM cache: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package doubao
+
+import (
+	"contentive/internal/llm"
+	"contentive/internal/llm/openai"
+	"context"
+	"errors"
+)
+
+// DefaultBaseURL is the chat completions endpoint of Volcengine Ark
+const DefaultBaseURL = "https://ark.cn-beijing.volces.com/api/v3/chat/completions"
+
+// DoubaoProvider calls Doubao models through Volcengine Ark. Ark speaks the
+// OpenAI chat completions protocol, but the model is the ID of an inference
+// endpoint (ep-...) or a model name enabled for the account, and there is no
+// default, so a model is required.
+type DoubaoProvider struct {
+	*openai.OpenAIProvider
+}
+
+var errNoModel = errors.New("doubao requires a model or inference endpoint ID, set LLM_MODEL")
+
+// NewDoubaoProvider creates a new DoubaoProvider
+func NewDoubaoProvider(apiKey, baseURL, model string) *DoubaoProvider {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	return &DoubaoProvider{
+		OpenAIProvider: openai.NewOpenAIProvider(apiKey, baseURL, model),
+	}
+}
+
+// Chat sends a chat request to Ark
+func (p *DoubaoProvider) Chat(ctx context.Context, req llm.LLMRequest) (*llm.LLMResponse, error) {
+	if req.Model == "" && p.Model == "" {
+		return nil, errNoModel
+	}
+	return p.OpenAIProvider.Chat(ctx, req)
+}
+
+// ChatStream sends a streaming chat request to Ark
+func (p *DoubaoProvider) ChatStream(ctx context.Context, req llm.LLMRequest) (<-chan llm.LLMStreamResponse, error) {
+	if req.Model == "" && p.Model == "" {
+		return nil, errNoModel
+	}
+	return p.OpenAIProvider.ChatStream(ctx, req)
+}
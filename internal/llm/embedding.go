@@ -0,0 +1,34 @@
+package llm
+
+import "context"
+
+type EmbeddingRequest struct {
+	Input []string `json:"input"`           // texts to embed in one batch
+	Model string   `json:"model,omitempty"` // overrides the provider's default model
+}
+
+type EmbeddingResponse struct {
+	Embeddings [][]float32 `json:"embeddings"` // one vector per input, in order
+	Model      string      `json:"model"`      // the model that produced the vectors
+}
+
+type EmbeddingProvider interface {
+	// Embed returns one embedding vector for each input text
+	Embed(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error)
+	// Dimensions returns the length of the vectors produced by the default model
+	Dimensions() int
+	// Model returns the default embedding model
+	Model() string
+}
+
+var embeddingProvider EmbeddingProvider
+
+// SetEmbeddingProvider sets the embedding provider
+func SetEmbeddingProvider(p EmbeddingProvider) {
+	embeddingProvider = p
+}
+
+// Get embedding provider
+func GetEmbeddingProvider() EmbeddingProvider {
+	return embeddingProvider
+}
@@ -0,0 +1,112 @@
+package hashing
+
+import (
+	"contentive/internal/llm"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// DefaultDimensions is the vector size used when none is configured
+const DefaultDimensions = 384
+
+// ErrNoTokens is returned for a text without words. Its vector would be all
+// zeros, which has no direction, and cosine distance to it is NaN.
+var ErrNoTokens = errors.New("text has no words to embed")
+
+// HashingEmbedder is a deterministic embedder that needs no external service.
+// Words and word pairs are hashed into a fixed number of buckets (the "hashing
+// trick"), so texts sharing vocabulary end up close to each other. It is meant
+// for tests and offline installs; it does not capture meaning like a model does.
+type HashingEmbedder struct {
+	dims int
+}
+
+// NewHashingEmbedder creates a new HashingEmbedder
+func NewHashingEmbedder(dimensions int) *HashingEmbedder {
+	if dimensions <= 0 {
+		dimensions = DefaultDimensions
+	}
+	return &HashingEmbedder{dims: dimensions}
+}
+
+// Model returns the embedder name, which includes the vector size so vectors of
+// different sizes are never mixed
+func (e *HashingEmbedder) Model() string {
+	return fmt.Sprintf("hashing-%d", e.dims)
+}
+
+// Dimensions returns the vector size
+func (e *HashingEmbedder) Dimensions() int {
+	return e.dims
+}
+
+// Embed hashes each input text into a normalized vector
+func (e *HashingEmbedder) Embed(ctx context.Context, req llm.EmbeddingRequest) (*llm.EmbeddingResponse, error) {
+	if req.Model != "" && req.Model != e.Model() {
+		return nil, fmt.Errorf("unsupported embedding model: %s", req.Model)
+	}
+
+	embeddings := make([][]float32, len(req.Input))
+	for i, text := range req.Input {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		vector := e.embed(text)
+		if vector == nil {
+			return nil, fmt.Errorf("input %d: %w", i, ErrNoTokens)
+		}
+		embeddings[i] = vector
+	}
+
+	return &llm.EmbeddingResponse{
+		Embeddings: embeddings,
+		Model:      e.Model(),
+	}, nil
+}
+
+// embed returns the unit vector of the text, or nil if it has no words
+func (e *HashingEmbedder) embed(text string) []float32 {
+	vector := make([]float32, e.dims)
+
+	tokens := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, token := range tokens {
+		e.add(vector, token, 1)
+		if i > 0 {
+			e.add(vector, tokens[i-1]+" "+token, 0.5)
+		}
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return nil
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
+
+// add hashes the feature into a bucket, using one hash bit as the sign so that
+// collisions tend to cancel out instead of piling up
+func (e *HashingEmbedder) add(vector []float32, feature string, weight float32) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+
+	bucket := int(sum % uint64(e.dims))
+	if sum&(1<<63) != 0 {
+		weight = -weight
+	}
+	vector[bucket] += weight
+}
@@ -0,0 +1,93 @@
+package hashing
+
+import (
+	"contentive/internal/llm"
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestEmbedIsDeterministic(t *testing.T) {
+	e := NewHashingEmbedder(64)
+	req := llm.EmbeddingRequest{Input: []string{"The quick brown fox", "jumps over the lazy dog"}}
+
+	first, err := e.Embed(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	second, err := NewHashingEmbedder(64).Embed(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+
+	for i := range req.Input {
+		if len(first.Embeddings[i]) != 64 {
+			t.Fatalf("input %d: got %d dimensions, want 64", i, len(first.Embeddings[i]))
+		}
+		for j := range first.Embeddings[i] {
+			if first.Embeddings[i][j] != second.Embeddings[i][j] {
+				t.Fatalf("input %d: vectors differ at %d", i, j)
+			}
+		}
+	}
+	if first.Model != "hashing-64" {
+		t.Errorf("got model %q, want hashing-64", first.Model)
+	}
+}
+
+func TestEmbedUnitNorm(t *testing.T) {
+	e := NewHashingEmbedder(0)
+	resp, err := e.Embed(context.Background(), llm.EmbeddingRequest{Input: []string{
+		"a",
+		"Hello, world!",
+		"Ünïcödé wörds and numbers 42",
+		"repeated repeated repeated repeated",
+	}})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+
+	for i, vector := range resp.Embeddings {
+		if len(vector) != DefaultDimensions {
+			t.Fatalf("input %d: got %d dimensions, want %d", i, len(vector), DefaultDimensions)
+		}
+		var norm float64
+		for _, v := range vector {
+			norm += float64(v) * float64(v)
+		}
+		if math.Abs(math.Sqrt(norm)-1) > 1e-5 {
+			t.Errorf("input %d: got norm %f, want 1", i, math.Sqrt(norm))
+		}
+	}
+}
+
+func TestEmbedCaseAndPunctuationInsensitive(t *testing.T) {
+	e := NewHashingEmbedder(128)
+	resp, err := e.Embed(context.Background(), llm.EmbeddingRequest{Input: []string{"Hello, World!", "hello world"}})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	for j := range resp.Embeddings[0] {
+		if resp.Embeddings[0][j] != resp.Embeddings[1][j] {
+			t.Fatalf("vectors differ at %d", j)
+		}
+	}
+}
+
+func TestEmbedWithoutWords(t *testing.T) {
+	e := NewHashingEmbedder(32)
+	for _, text := range []string{"", "   ", "!!! --- ???"} {
+		_, err := e.Embed(context.Background(), llm.EmbeddingRequest{Input: []string{"words", text}})
+		if !errors.Is(err, ErrNoTokens) {
+			t.Errorf("%q: got error %v, want ErrNoTokens", text, err)
+		}
+	}
+}
+
+func TestEmbedRejectsOtherModel(t *testing.T) {
+	e := NewHashingEmbedder(32)
+	if _, err := e.Embed(context.Background(), llm.EmbeddingRequest{Input: []string{"text"}, Model: "hashing-64"}); err == nil {
+		t.Error("expected an error for another model")
+	}
+}
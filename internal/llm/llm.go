@@ -1,28 +1,120 @@
 package llm
 
-import "context"
+import (
+	"context"
+	"fmt"
+)
+
+// Message roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Message is one turn of a conversation
+type Message struct {
+	Role       string     `json:"role"` // system, user, assistant or tool
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // tools requested by an assistant message
+	ToolCallID string     `json:"tool_call_id,omitempty"` // the call a tool message answers
+}
 
 type LLMRequest struct {
-	Prompt      string                 `json:"prompt"`
+	Messages    []Message              `json:"messages,omitempty"` // the conversation, in order
+	Prompt      string                 `json:"prompt,omitempty"`   // shorthand for a final user message
 	MaxTokens   int                    `json:"max_tokens,omitempty"`
-	Temperature float64                `json:"temperature,omitempty"`
+	Temperature *float64               `json:"temperature,omitempty"` // nil leaves it to the provider's default
 	TopP        float64                `json:"top_p,omitempty"`
 	Model       string                 `json:"model,omitempty"`
 	Stream      bool                   `json:"stream,omitempty"`
+	Tools       []Tool                 `json:"tools,omitempty"`       // tools the model may call
+	ToolChoice  string                 `json:"tool_choice,omitempty"` // auto or none, defaults to auto
+	Format      *ResponseFormat        `json:"response_format,omitempty"`
+	NoCache     bool                   `json:"no_cache,omitempty"` // skip the response cache
 	ExtraParams map[string]interface{} `json:"extra_params,omitempty"`
 }
 
+// Response formats
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object" // any JSON object
+	ResponseFormatJSONSchema = "json_schema" // JSON matching Schema
+)
+
+// ResponseFormat asks the model for structured output
+type ResponseFormat struct {
+	Type   string                 `json:"type"`
+	Name   string                 `json:"name,omitempty"`   // name of the schema, for json_schema
+	Schema map[string]interface{} `json:"schema,omitempty"` // JSON schema of the output, for json_schema
+}
+
+// ChatMessages returns the messages to send, with Prompt appended as a user message
+func (r LLMRequest) ChatMessages() []Message {
+	messages := make([]Message, 0, len(r.Messages)+1)
+	messages = append(messages, r.Messages...)
+	if r.Prompt != "" {
+		messages = append(messages, Message{Role: RoleUser, Content: r.Prompt})
+	}
+	return messages
+}
+
+// ValidateMessages checks that every message has a known role and content.
+// Tool messages are only produced by the tool loop and are rejected here.
+func ValidateMessages(messages []Message) error {
+	for i, message := range messages {
+		switch message.Role {
+		case RoleSystem, RoleUser, RoleAssistant:
+		default:
+			return fmt.Errorf("message %d: invalid role '%s'", i, message.Role)
+		}
+		if message.Content == "" {
+			return fmt.Errorf("message %d: content is required", i)
+		}
+	}
+	return nil
+}
+
+// Usage is the number of tokens a request consumed
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Add adds the tokens of other to u
+func (u *Usage) Add(other *Usage) {
+	if other == nil {
+		return
+	}
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
 type LLMResponse struct {
-	Text         string `json:"text"`
-	FinishReason string `json:"finish_reason"` // the reson why the generation finished
+	Text         string     `json:"text"`
+	FinishReason string     `json:"finish_reason"`        // the reson why the generation finished
+	ToolCalls    []ToolCall `json:"tool_calls,omitempty"` // tools requested by the model, with results once executed
+	Usage        *Usage     `json:"usage,omitempty"`      // tokens consumed, if the provider reports them
+	Provider     string     `json:"provider,omitempty"`   // the backend that served the request, set by the router
+	Cache        string     `json:"-"`                    // hit, miss or bypass, set by the response cache
 }
 
 type LLMStreamResponse struct {
 	Text         string `json:"text"`
 	FinishReason string `json:"finish_reason,omitempty"`
 	Done         bool   `json:"done"`
+	Usage        *Usage `json:"usage,omitempty"`    // tokens consumed, on the last response only
+	Provider     string `json:"provider,omitempty"` // the backend that served the request, set by the router
+	Error        string `json:"error,omitempty"`    // why the stream failed, on the last response only
 }
 
+// StreamIncomplete is the error of a stream that ended before the reply
+// was finished
+const StreamIncomplete = "Stream ended before the reply was complete"
+
 type LLMProvider interface {
 	// Get full response
 	Chat(ctx context.Context, req LLMRequest) (*LLMResponse, error)
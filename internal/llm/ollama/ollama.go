@@ -0,0 +1,304 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"contentive/internal/llm"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultBaseURL is the address of a local Ollama server
+const DefaultBaseURL = "http://localhost:11434"
+
+// OllamaProvider calls the /api/chat endpoint of Ollama or a compatible local
+// server. No API key is needed, but one is sent as a bearer token if set, for
+// servers behind an authenticating proxy.
+type OllamaProvider struct {
+	APIKey  string
+	BaseURL string // server address, /api/chat is appended
+	Model   string
+	Client  *http.Client
+}
+
+type OllamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+}
+
+// OllamaToolCall represents a function call. Ollama passes the arguments as
+// an object and has no call IDs.
+type OllamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// OllamaTool represents a function the model may call
+type OllamaTool struct {
+	Type     string   `json:"type"`
+	Function llm.Tool `json:"function"`
+}
+
+// OllamaChatRequest represents a request to the Ollama API
+type OllamaChatRequest struct {
+	Model    string                 `json:"model"`
+	Messages []OllamaMessage        `json:"messages"`
+	Stream   bool                   `json:"stream"`
+	Tools    []OllamaTool           `json:"tools,omitempty"`
+	Format   interface{}            `json:"format,omitempty"` // "json" or a JSON schema
+	Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+// OllamaChatResponse represents a response, or one line of a stream, from the Ollama API
+type OllamaChatResponse struct {
+	Model      string        `json:"model"`
+	Message    OllamaMessage `json:"message"`
+	Done       bool          `json:"done"`
+	DoneReason string        `json:"done_reason"`
+	Error      string        `json:"error"`
+	// Token counts, in the last response only
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+}
+
+// usage returns the token usage of a finished response
+func (r *OllamaChatResponse) usage() *llm.Usage {
+	if !r.Done {
+		return nil
+	}
+	return &llm.Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+// NewOllamaProvider creates a new OllamaProvider
+func NewOllamaProvider(apiKey, baseURL, model string) *OllamaProvider {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	return &OllamaProvider{
+		APIKey:  apiKey,
+		BaseURL: baseURL,
+		Model:   model,
+		Client:  &http.Client{},
+	}
+}
+
+// chatURL returns the chat endpoint, accepting a base URL that already points at it
+func (p *OllamaProvider) chatURL() string {
+	if strings.HasSuffix(p.BaseURL, "/api/chat") {
+		return p.BaseURL
+	}
+	return strings.TrimRight(p.BaseURL, "/") + "/api/chat"
+}
+
+// newRequest builds the Ollama request. Generation settings go into options,
+// where max tokens is called num_predict.
+func (p *OllamaProvider) newRequest(ctx context.Context, req llm.LLMRequest, stream bool) (*http.Request, error) {
+	model := p.Model
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	ollamaReq := OllamaChatRequest{
+		Model:   model,
+		Stream:  stream,
+		Options: map[string]interface{}{},
+	}
+	for _, message := range req.ChatMessages() {
+		ollamaMessage := OllamaMessage{Role: message.Role, Content: message.Content}
+		for _, call := range message.ToolCalls {
+			var ollamaCall OllamaToolCall
+			ollamaCall.Function.Name = call.Name
+			ollamaCall.Function.Arguments = json.RawMessage(call.Arguments)
+			if !json.Valid(ollamaCall.Function.Arguments) {
+				ollamaCall.Function.Arguments = json.RawMessage("{}")
+			}
+			ollamaMessage.ToolCalls = append(ollamaMessage.ToolCalls, ollamaCall)
+		}
+		ollamaReq.Messages = append(ollamaReq.Messages, ollamaMessage)
+	}
+
+	// Ollama has no tool choice, so tools are left out when they may not be used
+	if req.ToolChoice != llm.ToolChoiceNone {
+		for _, tool := range req.Tools {
+			ollamaReq.Tools = append(ollamaReq.Tools, OllamaTool{Type: "function", Function: tool})
+		}
+	}
+
+	if req.Format != nil {
+		switch req.Format.Type {
+		case llm.ResponseFormatJSONObject:
+			ollamaReq.Format = "json"
+		case llm.ResponseFormatJSONSchema:
+			ollamaReq.Format = req.Format.Schema
+		}
+	}
+
+	if req.MaxTokens > 0 {
+		ollamaReq.Options["num_predict"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		ollamaReq.Options["temperature"] = *req.Temperature
+	}
+	if req.TopP > 0 {
+		ollamaReq.Options["top_p"] = req.TopP
+	}
+
+	reqBody, err := json.Marshal(ollamaReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.chatURL(), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.APIKey))
+	}
+	return httpReq, nil
+}
+
+// Chat sends a chat request to the Ollama API
+func (p *OllamaProvider) Chat(ctx context.Context, req llm.LLMRequest) (*llm.LLMResponse, error) {
+	httpReq, err := p.newRequest(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &llm.APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var ollamaResp OllamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+	if ollamaResp.Error != "" {
+		return nil, fmt.Errorf("API request failed: %s", ollamaResp.Error)
+	}
+
+	var toolCalls []llm.ToolCall
+	for i, call := range ollamaResp.Message.ToolCalls {
+		toolCalls = append(toolCalls, llm.ToolCall{
+			ID:        fmt.Sprintf("call_%d", i),
+			Name:      call.Function.Name,
+			Arguments: string(call.Function.Arguments),
+		})
+	}
+
+	finishReason := ollamaResp.DoneReason
+	if len(toolCalls) > 0 {
+		finishReason = "tool_calls"
+	}
+
+	return &llm.LLMResponse{
+		Text:         ollamaResp.Message.Content,
+		FinishReason: finishReason,
+		ToolCalls:    toolCalls,
+		Usage:        ollamaResp.usage(),
+	}, nil
+}
+
+// ChatStream sends a streaming chat request to the Ollama API, which answers
+// with one JSON object per line
+func (p *OllamaProvider) ChatStream(ctx context.Context, req llm.LLMRequest) (<-chan llm.LLMStreamResponse, error) {
+	httpReq, err := p.newRequest(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &llm.APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	responseChan := make(chan llm.LLMStreamResponse)
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(responseChan)
+
+		send := func(r llm.LLMStreamResponse) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case responseChan <- r:
+				return true
+			}
+		}
+
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				var chunk OllamaChatResponse
+				if jsonErr := json.Unmarshal(line, &chunk); jsonErr == nil {
+					if chunk.Error != "" {
+						send(llm.LLMStreamResponse{
+							Error: fmt.Sprintf("Error from API: %s", chunk.Error),
+							Done:  true,
+						})
+						return
+					}
+
+					finishReason := ""
+					if chunk.Done {
+						finishReason = chunk.DoneReason
+						if finishReason == "" {
+							finishReason = "stop"
+						}
+					}
+					if !send(llm.LLMStreamResponse{
+						Text:         chunk.Message.Content,
+						FinishReason: finishReason,
+						Done:         chunk.Done,
+						Usage:        chunk.usage(),
+					}) || chunk.Done {
+						return
+					}
+				}
+			}
+
+			if err != nil {
+				if err != io.EOF {
+					send(llm.LLMStreamResponse{
+						Error: fmt.Sprintf("Error reading stream: %v", err),
+						Done:  true,
+					})
+				} else {
+					send(llm.LLMStreamResponse{Error: llm.StreamIncomplete, Done: true})
+				}
+				return
+			}
+		}
+	}()
+
+	return responseChan, nil
+}
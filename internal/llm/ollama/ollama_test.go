@@ -0,0 +1,231 @@
+package ollama
+
+import (
+	"contentive/internal/llm"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// stubServer serves /api/chat with handler and records the decoded requests
+func stubServer(t *testing.T, handler func(w http.ResponseWriter, req OllamaChatRequest)) (*httptest.Server, *[]OllamaChatRequest) {
+	t.Helper()
+	var requests []OllamaChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		var req OllamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			http.Error(w, "bad authorization "+got, http.StatusUnauthorized)
+			return
+		}
+		requests = append(requests, req)
+		handler(w, req)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestChat(t *testing.T) {
+	server, requests := stubServer(t, func(w http.ResponseWriter, req OllamaChatRequest) {
+		fmt.Fprint(w, `{"model":"llama3.1","message":{"role":"assistant","content":"Hello there"},"done":true,"done_reason":"stop","prompt_eval_count":12,"eval_count":3}`)
+	})
+
+	p := NewOllamaProvider("secret", server.URL, "llama3.1")
+	resp, err := p.Chat(context.Background(), llm.LLMRequest{
+		Messages:  []llm.Message{{Role: llm.RoleSystem, Content: "Be brief"}},
+		Prompt:    "Hi",
+		MaxTokens: 64,
+	})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+
+	if resp.Text != "Hello there" || resp.FinishReason != "stop" {
+		t.Errorf("got text %q, finish reason %q", resp.Text, resp.FinishReason)
+	}
+	if resp.Usage == nil || resp.Usage.PromptTokens != 12 || resp.Usage.CompletionTokens != 3 || resp.Usage.TotalTokens != 15 {
+		t.Errorf("got usage %+v", resp.Usage)
+	}
+
+	if len(*requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*requests))
+	}
+	req := (*requests)[0]
+	if req.Model != "llama3.1" || req.Stream {
+		t.Errorf("got model %q, stream %v", req.Model, req.Stream)
+	}
+	if len(req.Messages) != 2 || req.Messages[0].Role != llm.RoleSystem || req.Messages[1].Content != "Hi" {
+		t.Errorf("got messages %+v", req.Messages)
+	}
+	if req.Options["num_predict"] != float64(64) {
+		t.Errorf("got options %v, want num_predict 64", req.Options)
+	}
+}
+
+func TestChatToolCalls(t *testing.T) {
+	server, requests := stubServer(t, func(w http.ResponseWriter, req OllamaChatRequest) {
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"search","arguments":{"q":"go"}}}]},"done":true,"done_reason":"stop"}`)
+	})
+
+	p := NewOllamaProvider("secret", server.URL+"/api/chat", "llama3.1")
+	resp, err := p.Chat(context.Background(), llm.LLMRequest{
+		Prompt: "Find posts about go",
+		Tools:  []llm.Tool{{Name: "search", Description: "Search posts"}},
+	})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+
+	if resp.FinishReason != "tool_calls" || len(resp.ToolCalls) != 1 {
+		t.Fatalf("got finish reason %q, tool calls %+v", resp.FinishReason, resp.ToolCalls)
+	}
+	call := resp.ToolCalls[0]
+	if call.ID != "call_0" || call.Name != "search" || call.Arguments != `{"q":"go"}` {
+		t.Errorf("got tool call %+v", call)
+	}
+	if len((*requests)[0].Tools) != 1 || (*requests)[0].Tools[0].Function.Name != "search" {
+		t.Errorf("got tools %+v", (*requests)[0].Tools)
+	}
+}
+
+func TestChatAPIError(t *testing.T) {
+	server, _ := stubServer(t, func(w http.ResponseWriter, req OllamaChatRequest) {
+		http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+	})
+
+	p := NewOllamaProvider("secret", server.URL, "missing")
+	_, err := p.Chat(context.Background(), llm.LLMRequest{Prompt: "Hi"})
+
+	var apiErr *llm.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("got error %v, want an APIError with status 404", err)
+	}
+}
+
+func TestChatStream(t *testing.T) {
+	server, requests := stubServer(t, func(w http.ResponseWriter, req OllamaChatRequest) {
+		flusher := w.(http.Flusher)
+		for _, line := range []string{
+			`{"message":{"role":"assistant","content":"Hel"},"done":false}`,
+			`{"message":{"role":"assistant","content":"lo"},"done":false}`,
+			`{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":5,"eval_count":2}`,
+		} {
+			fmt.Fprintln(w, line)
+			flusher.Flush()
+		}
+	})
+
+	p := NewOllamaProvider("secret", server.URL, "llama3.1")
+	stream, err := p.ChatStream(context.Background(), llm.LLMRequest{Prompt: "Hi"})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+
+	var text string
+	var last llm.LLMStreamResponse
+	for chunk := range stream {
+		text += chunk.Text
+		last = chunk
+	}
+
+	if text != "Hello" {
+		t.Errorf("got text %q, want Hello", text)
+	}
+	if !last.Done || last.FinishReason != "stop" {
+		t.Errorf("got last chunk %+v", last)
+	}
+	if last.Usage == nil || last.Usage.TotalTokens != 7 {
+		t.Errorf("got usage %+v", last.Usage)
+	}
+	if !(*requests)[0].Stream {
+		t.Error("stream was not requested")
+	}
+}
+
+func TestChatStreamError(t *testing.T) {
+	server, _ := stubServer(t, func(w http.ResponseWriter, req OllamaChatRequest) {
+		fmt.Fprintln(w, `{"error":"out of memory"}`)
+	})
+
+	p := NewOllamaProvider("secret", server.URL, "llama3.1")
+	stream, err := p.ChatStream(context.Background(), llm.LLMRequest{Prompt: "Hi"})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+
+	var chunks []llm.LLMStreamResponse
+	for chunk := range stream {
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) != 1 || !chunks[0].Done || chunks[0].Error != "Error from API: out of memory" {
+		t.Errorf("got chunks %+v", chunks)
+	}
+}
+
+func TestChatStreamIncomplete(t *testing.T) {
+	server, _ := stubServer(t, func(w http.ResponseWriter, req OllamaChatRequest) {
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"Hel"},"done":false}`)
+	})
+
+	p := NewOllamaProvider("secret", server.URL, "llama3.1")
+	stream, err := p.ChatStream(context.Background(), llm.LLMRequest{Prompt: "Hi"})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+
+	var last llm.LLMStreamResponse
+	for chunk := range stream {
+		last = chunk
+	}
+	if !last.Done || last.Error != llm.StreamIncomplete || last.FinishReason != "" {
+		t.Errorf("got last chunk %+v, want an incomplete stream error", last)
+	}
+}
+
+func TestChatStreamCancel(t *testing.T) {
+	release := make(chan struct{})
+	server, _ := stubServer(t, func(w http.ResponseWriter, req OllamaChatRequest) {
+		flusher := w.(http.Flusher)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"first"},"done":false}`)
+		flusher.Flush()
+		<-release
+	})
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewOllamaProvider("secret", server.URL, "llama3.1")
+	stream, err := p.ChatStream(ctx, llm.LLMRequest{Prompt: "Hi"})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+
+	if chunk := <-stream; chunk.Text != "first" {
+		t.Fatalf("got first chunk %+v", chunk)
+	}
+	cancel()
+
+	// The stream must close once the request is cancelled
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-stream:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("stream was not closed after cancel")
+		}
+	}
+}
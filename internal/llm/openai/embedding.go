@@ -0,0 +1,177 @@
+package openai
+
+import (
+	"bytes"
+	"contentive/internal/llm"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DefaultEmbeddingModel is used when no embedding model is configured
+const DefaultEmbeddingModel = "text-embedding-3-small"
+
+// knownEmbeddingDimensions are the default vector sizes of OpenAI embedding models
+var knownEmbeddingDimensions = map[string]int{
+	"text-embedding-3-small": 1536,
+	"text-embedding-3-large": 3072,
+	"text-embedding-ada-002": 1536,
+}
+
+// OpenAIEmbeddingProvider calls an OpenAI compatible /embeddings endpoint
+type OpenAIEmbeddingProvider struct {
+	APIKey  string
+	BaseURL string // full URL of the embeddings endpoint
+	model   string
+	dims    int // configured vector size, sent to the API
+	learned int // vector size observed for a model of unknown size
+	mu      sync.RWMutex
+	Client  *http.Client
+}
+
+// OpenAIEmbeddingRequest represents an embedding request to the OpenAI API
+type OpenAIEmbeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+// OpenAIEmbeddingResponse represents an embedding response from the OpenAI API
+type OpenAIEmbeddingResponse struct {
+	Object string `json:"object"`
+	Model  string `json:"model"`
+	Data   []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// NewOpenAIEmbeddingProvider creates a new OpenAIEmbeddingProvider. If dimensions
+// is 0, the model's native size is used.
+func NewOpenAIEmbeddingProvider(apiKey, baseURL, model string, dimensions int) *OpenAIEmbeddingProvider {
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1/embeddings"
+	}
+	if model == "" {
+		model = DefaultEmbeddingModel
+	}
+
+	return &OpenAIEmbeddingProvider{
+		APIKey:  apiKey,
+		BaseURL: baseURL,
+		model:   model,
+		dims:    dimensions,
+		Client:  &http.Client{},
+	}
+}
+
+// EmbeddingsURL derives the embeddings endpoint from a chat completions URL
+func EmbeddingsURL(chatURL string) string {
+	if strings.HasSuffix(chatURL, "/chat/completions") {
+		return strings.TrimSuffix(chatURL, "/chat/completions") + "/embeddings"
+	}
+	return strings.TrimRight(chatURL, "/") + "/embeddings"
+}
+
+// Model returns the default embedding model
+func (p *OpenAIEmbeddingProvider) Model() string {
+	return p.model
+}
+
+// Dimensions returns the vector size of the default model. For unknown models
+// it is learned from the first response and is 0 until then.
+func (p *OpenAIEmbeddingProvider) Dimensions() int {
+	if p.dims > 0 {
+		return p.dims
+	}
+	if dims, ok := knownEmbeddingDimensions[p.model]; ok {
+		return dims
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.learned
+}
+
+// Embed sends an embedding request to the OpenAI API
+func (p *OpenAIEmbeddingProvider) Embed(ctx context.Context, req llm.EmbeddingRequest) (*llm.EmbeddingResponse, error) {
+	model := p.model
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	if len(req.Input) == 0 {
+		return &llm.EmbeddingResponse{Embeddings: [][]float32{}, Model: model}, nil
+	}
+
+	openAIReq := OpenAIEmbeddingRequest{
+		Model: model,
+		Input: req.Input,
+	}
+	// Only ask for shortened vectors from the configured model
+	if model == p.model {
+		openAIReq.Dimensions = p.dims
+	}
+
+	reqBody, err := json.Marshal(openAIReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		p.BaseURL,
+		bytes.NewBuffer(reqBody),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.APIKey))
+
+	resp, err := p.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &llm.APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var embeddingResp OpenAIEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embeddingResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	if len(embeddingResp.Data) != len(req.Input) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(req.Input), len(embeddingResp.Data))
+	}
+
+	// The API may return the embeddings out of order, so place them by index
+	embeddings := make([][]float32, len(req.Input))
+	for _, d := range embeddingResp.Data {
+		if d.Index < 0 || d.Index >= len(req.Input) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		embeddings[d.Index] = d.Embedding
+	}
+
+	// Remember the vector size of the default model if it was not known
+	if model == p.model && p.dims == 0 && knownEmbeddingDimensions[p.model] == 0 {
+		p.mu.Lock()
+		p.learned = len(embeddings[0])
+		p.mu.Unlock()
+	}
+
+	return &llm.EmbeddingResponse{
+		Embeddings: embeddings,
+		Model:      model,
+	}, nil
+}
@@ -20,8 +20,30 @@ type OpenAIProvider struct {
 }
 
 type OpenAIChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// OpenAITool represents a function the model may call
+type OpenAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description,omitempty"`
+		Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+// OpenAIToolCall represents a function call requested by the model
+type OpenAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
 }
 
 // OpenAIChatRequest represents a request to the OpenAI API
@@ -29,9 +51,49 @@ type OpenAIChatRequest struct {
 	Model       string              `json:"model"`
 	Messages    []OpenAIChatMessage `json:"messages"`
 	MaxTokens   int                 `json:"max_tokens,omitempty"`
-	Temperature float64             `json:"temperature,omitempty"`
+	Temperature *float64            `json:"temperature,omitempty"`
 	TopP        float64             `json:"top_p,omitempty"`
 	Stream      bool                `json:"stream,omitempty"`
+	StreamOpts  *OpenAIStreamOpts   `json:"stream_options,omitempty"`
+	Tools       []OpenAITool        `json:"tools,omitempty"`
+	ToolChoice  string              `json:"tool_choice,omitempty"`
+	Format      *OpenAIFormat       `json:"response_format,omitempty"`
+}
+
+// OpenAIStreamOpts asks for the usage to be sent in the last stream chunk
+type OpenAIStreamOpts struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// OpenAIUsage represents the token usage of a request
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// toUsage converts the OpenAI usage, which may be missing
+func (u *OpenAIUsage) toUsage() *llm.Usage {
+	if u == nil {
+		return nil
+	}
+	return &llm.Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+}
+
+// OpenAIFormat represents the response format of a chat request
+type OpenAIFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+// OpenAIJSONSchema represents the schema of a structured output
+type OpenAIJSONSchema struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
 }
 
 // OpenAIChatResponse represents a response from the OpenAI API
@@ -45,6 +107,7 @@ type OpenAIChatResponse struct {
 		Message      OpenAIChatMessage `json:"message"`
 		FinishReason string            `json:"finish_reason"`
 	} `json:"choices"`
+	Usage *OpenAIUsage `json:"usage"`
 }
 
 // OpenAIChatStreamResponse represents a response from the OpenAI API
@@ -60,6 +123,7 @@ type OpenAIChatStreamResponse struct {
 		} `json:"delta"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
+	Usage *OpenAIUsage `json:"usage"` // only in the last chunk
 }
 
 // NewOpenAIProvider creates a new OpenAIProvider
@@ -84,16 +148,14 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req llm.LLMRequest) (*llm.LLM
 	}
 
 	openAIReq := OpenAIChatRequest{
-		Model: model,
-		Messages: []OpenAIChatMessage{
-			{
-				Role:    "user",
-				Content: req.Prompt,
-			},
-		},
+		Model:       model,
+		Messages:    chatMessages(req),
 		MaxTokens:   req.MaxTokens,
 		Temperature: req.Temperature,
 		TopP:        req.TopP,
+		Tools:       tools(req.Tools),
+		ToolChoice:  req.ToolChoice,
+		Format:      responseFormat(req.Format),
 	}
 
 	reqBody, err := json.Marshal(openAIReq)
@@ -116,13 +178,13 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req llm.LLMRequest) (*llm.LLM
 
 	resp, err := p.Client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, &llm.APIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var openAIResp OpenAIChatResponse
@@ -134,9 +196,20 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req llm.LLMRequest) (*llm.LLM
 		return nil, fmt.Errorf("no choices in response")
 	}
 
+	var toolCalls []llm.ToolCall
+	for _, call := range openAIResp.Choices[0].Message.ToolCalls {
+		toolCalls = append(toolCalls, llm.ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+
 	return &llm.LLMResponse{
 		Text:         openAIResp.Choices[0].Message.Content,
 		FinishReason: openAIResp.Choices[0].FinishReason,
+		ToolCalls:    toolCalls,
+		Usage:        openAIResp.Usage.toUsage(),
 	}, nil
 }
 
@@ -148,17 +221,13 @@ func (p *OpenAIProvider) ChatStream(ctx context.Context, req llm.LLMRequest) (<-
 	}
 
 	openAIReq := OpenAIChatRequest{
-		Model: model,
-		Messages: []OpenAIChatMessage{
-			{
-				Role:    "user",
-				Content: req.Prompt,
-			},
-		},
+		Model:       model,
+		Messages:    chatMessages(req),
 		MaxTokens:   req.MaxTokens,
 		Temperature: req.Temperature,
 		TopP:        req.TopP,
 		Stream:      true,
+		StreamOpts:  &OpenAIStreamOpts{IncludeUsage: true},
 	}
 
 	reqBody, err := json.Marshal(openAIReq)
@@ -181,13 +250,13 @@ func (p *OpenAIProvider) ChatStream(ctx context.Context, req llm.LLMRequest) (<-
 
 	resp, err := p.Client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		resp.Body.Close()
+		return nil, &llm.APIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	responseChan := make(chan llm.LLMStreamResponse)
@@ -196,58 +265,77 @@ func (p *OpenAIProvider) ChatStream(ctx context.Context, req llm.LLMRequest) (<-
 		defer resp.Body.Close()
 		defer close(responseChan)
 
-		reader := bufio.NewReader(resp.Body)
-
-		for {
+		send := func(r llm.LLMStreamResponse) bool {
 			select {
-			// When the context is done, return
 			case <-ctx.Done():
-				return
-			// Otherwise, read the stream
-			default:
-				line, err := reader.ReadString('\n')
-				if err != nil {
-					if err != io.EOF {
-						responseChan <- llm.LLMStreamResponse{
-							Text: fmt.Sprintf("Error reading stream: %v", err),
-							Done: true,
-						}
-					}
-					return
-				}
+				return false
+			case responseChan <- r:
+				return true
+			}
+		}
 
-				line = strings.TrimSpace(line)
-				if line == "" {
-					continue
-				}
+		reader := bufio.NewReader(resp.Body)
+		var finishReason string
+		var usage *llm.Usage
 
-				if !strings.HasPrefix(line, "data: ") {
-					continue
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				if err != io.EOF {
+					send(llm.LLMStreamResponse{
+						Error: fmt.Sprintf("Error reading stream: %v", err),
+						Done:  true,
+					})
+				} else if finishReason != "" {
+					send(llm.LLMStreamResponse{
+						FinishReason: finishReason,
+						Done:         true,
+						Usage:        usage,
+					})
+				} else {
+					send(llm.LLMStreamResponse{Error: llm.StreamIncomplete, Done: true})
 				}
+				return
+			}
 
-				data := strings.TrimPrefix(line, "data: ")
-				if data == "[DONE]" {
-					responseChan <- llm.LLMStreamResponse{Done: true}
-					return
-				}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
 
-				var streamResp OpenAIChatStreamResponse
-				if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
-					continue
-				}
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
 
-				if len(streamResp.Choices) == 0 {
-					continue
-				}
+			data := strings.TrimPrefix(line, "data: ")
+			if data == "[DONE]" {
+				send(llm.LLMStreamResponse{
+					FinishReason: finishReason,
+					Done:         true,
+					Usage:        usage,
+				})
+				return
+			}
 
-				choice := streamResp.Choices[0]
-				responseChan <- llm.LLMStreamResponse{
-					Text:         choice.Delta.Content,
-					FinishReason: choice.FinishReason,
-					Done:         choice.FinishReason != "",
-				}
+			var streamResp OpenAIChatStreamResponse
+			if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
+				continue
+			}
 
-				if choice.FinishReason != "" {
+			// The usage chunk comes after the finish reason and has no choices
+			if streamResp.Usage != nil {
+				usage = streamResp.Usage.toUsage()
+			}
+			if len(streamResp.Choices) == 0 {
+				continue
+			}
+
+			choice := streamResp.Choices[0]
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+			if choice.Delta.Content != "" {
+				if !send(llm.LLMStreamResponse{Text: choice.Delta.Content}) {
 					return
 				}
 			}
@@ -256,3 +344,51 @@ func (p *OpenAIProvider) ChatStream(ctx context.Context, req llm.LLMRequest) (<-
 
 	return responseChan, nil
 }
+
+// chatMessages converts the request messages to OpenAI chat messages
+func chatMessages(req llm.LLMRequest) []OpenAIChatMessage {
+	messages := req.ChatMessages()
+	openAIMessages := make([]OpenAIChatMessage, len(messages))
+	for i, message := range messages {
+		openAIMessages[i] = OpenAIChatMessage{
+			Role:       message.Role,
+			Content:    message.Content,
+			ToolCallID: message.ToolCallID,
+		}
+		for _, call := range message.ToolCalls {
+			var openAICall OpenAIToolCall
+			openAICall.ID = call.ID
+			openAICall.Type = "function"
+			openAICall.Function.Name = call.Name
+			openAICall.Function.Arguments = call.Arguments
+			openAIMessages[i].ToolCalls = append(openAIMessages[i].ToolCalls, openAICall)
+		}
+	}
+	return openAIMessages
+}
+
+// tools converts tool definitions to OpenAI function tools
+func tools(defs []llm.Tool) []OpenAITool {
+	var openAITools []OpenAITool
+	for _, def := range defs {
+		var tool OpenAITool
+		tool.Type = "function"
+		tool.Function.Name = def.Name
+		tool.Function.Description = def.Description
+		tool.Function.Parameters = def.Parameters
+		openAITools = append(openAITools, tool)
+	}
+	return openAITools
+}
+
+// responseFormat converts the requested response format
+func responseFormat(format *llm.ResponseFormat) *OpenAIFormat {
+	if format == nil {
+		return nil
+	}
+	openAIFormat := &OpenAIFormat{Type: format.Type}
+	if format.Type == llm.ResponseFormatJSONSchema {
+		openAIFormat.JSONSchema = &OpenAIJSONSchema{Name: format.Name, Schema: format.Schema}
+	}
+	return openAIFormat
+}
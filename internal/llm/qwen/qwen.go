@@ -0,0 +1,334 @@
+package qwen
+
+import (
+	"bufio"
+	"bytes"
+	"contentive/internal/llm"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultBaseURL is the DashScope text generation endpoint
+	DefaultBaseURL = "https://dashscope.aliyuncs.com/api/v1/services/aigc/text-generation/generation"
+	// DefaultModel is used when no model is configured
+	DefaultModel = "qwen-plus"
+)
+
+// IsCompatibleModeURL reports whether the URL is an endpoint of the OpenAI
+// compatible mode of DashScope, which the native client cannot call
+func IsCompatibleModeURL(baseURL string) bool {
+	return strings.Contains(baseURL, "/compatible-mode/")
+}
+
+// QwenProvider calls the native DashScope API of Alibaba Cloud
+type QwenProvider struct {
+	APIKey  string
+	BaseURL string // full URL of the text generation endpoint
+	Model   string
+	Client  *http.Client
+}
+
+type QwenMessage struct {
+	Role       string         `json:"role"`
+	Content    string         `json:"content"`
+	ToolCalls  []QwenToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+// QwenToolCall represents a function call, DashScope uses the OpenAI layout
+type QwenToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// QwenTool represents a function the model may call
+type QwenTool struct {
+	Type     string   `json:"type"`
+	Function llm.Tool `json:"function"`
+}
+
+// QwenChatRequest represents a request to the DashScope API
+type QwenChatRequest struct {
+	Model string `json:"model"`
+	Input struct {
+		Messages []QwenMessage `json:"messages"`
+	} `json:"input"`
+	Parameters QwenParameters `json:"parameters"`
+}
+
+// QwenParameters holds the generation parameters of a DashScope request
+type QwenParameters struct {
+	ResultFormat      string                 `json:"result_format"`
+	MaxTokens         int                    `json:"max_tokens,omitempty"`
+	Temperature       *float64               `json:"temperature,omitempty"`
+	TopP              float64                `json:"top_p,omitempty"`
+	IncrementalOutput bool                   `json:"incremental_output,omitempty"`
+	Tools             []QwenTool             `json:"tools,omitempty"`
+	ToolChoice        string                 `json:"tool_choice,omitempty"`
+	ResponseFormat    map[string]interface{} `json:"response_format,omitempty"`
+}
+
+// QwenChatResponse represents a response, or a stream event, from the DashScope API
+type QwenChatResponse struct {
+	RequestID string `json:"request_id"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Output    struct {
+		Choices []struct {
+			FinishReason string      `json:"finish_reason"`
+			Message      QwenMessage `json:"message"`
+		} `json:"choices"`
+	} `json:"output"`
+	Usage *QwenUsage `json:"usage"` // running total in stream events
+}
+
+// QwenUsage represents the token usage of a request
+type QwenUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// toUsage converts the DashScope usage, which may be missing
+func (u *QwenUsage) toUsage() *llm.Usage {
+	if u == nil {
+		return nil
+	}
+	total := u.TotalTokens
+	if total == 0 {
+		total = u.InputTokens + u.OutputTokens
+	}
+	return &llm.Usage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      total,
+	}
+}
+
+// NewQwenProvider creates a new QwenProvider
+func NewQwenProvider(apiKey, baseURL, model string) *QwenProvider {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if model == "" {
+		model = DefaultModel
+	}
+
+	return &QwenProvider{
+		APIKey:  apiKey,
+		BaseURL: baseURL,
+		Model:   model,
+		Client:  &http.Client{},
+	}
+}
+
+// newRequest builds the DashScope request. DashScope streams through SSE when
+// the X-DashScope-SSE header is set, and only sends new text with incremental output.
+func (p *QwenProvider) newRequest(ctx context.Context, req llm.LLMRequest, stream bool) (*http.Request, error) {
+	model := p.Model
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	qwenReq := QwenChatRequest{Model: model}
+	for _, message := range req.ChatMessages() {
+		qwenMessage := QwenMessage{
+			Role:       message.Role,
+			Content:    message.Content,
+			ToolCallID: message.ToolCallID,
+		}
+		for _, call := range message.ToolCalls {
+			var qwenCall QwenToolCall
+			qwenCall.ID = call.ID
+			qwenCall.Type = "function"
+			qwenCall.Function.Name = call.Name
+			qwenCall.Function.Arguments = call.Arguments
+			qwenMessage.ToolCalls = append(qwenMessage.ToolCalls, qwenCall)
+		}
+		qwenReq.Input.Messages = append(qwenReq.Input.Messages, qwenMessage)
+	}
+
+	qwenReq.Parameters = QwenParameters{
+		ResultFormat:      "message",
+		MaxTokens:         req.MaxTokens,
+		Temperature:       req.Temperature,
+		TopP:              req.TopP,
+		IncrementalOutput: stream,
+		ToolChoice:        req.ToolChoice,
+	}
+	for _, tool := range req.Tools {
+		qwenReq.Parameters.Tools = append(qwenReq.Parameters.Tools, QwenTool{Type: "function", Function: tool})
+	}
+	if req.Format != nil && req.Format.Type != llm.ResponseFormatText {
+		// DashScope only knows JSON objects, the schema is left to the prompt
+		qwenReq.Parameters.ResponseFormat = map[string]interface{}{"type": llm.ResponseFormatJSONObject}
+	}
+
+	reqBody, err := json.Marshal(qwenReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.BaseURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.APIKey))
+	if stream {
+		httpReq.Header.Set("X-DashScope-SSE", "enable")
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+	return httpReq, nil
+}
+
+// Chat sends a chat request to the DashScope API
+func (p *QwenProvider) Chat(ctx context.Context, req llm.LLMRequest) (*llm.LLMResponse, error) {
+	httpReq, err := p.newRequest(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &llm.APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var qwenResp QwenChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&qwenResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+	if qwenResp.Code != "" {
+		return nil, fmt.Errorf("API request failed with code %s: %s", qwenResp.Code, qwenResp.Message)
+	}
+	if len(qwenResp.Output.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+
+	choice := qwenResp.Output.Choices[0]
+	var toolCalls []llm.ToolCall
+	for _, call := range choice.Message.ToolCalls {
+		toolCalls = append(toolCalls, llm.ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+
+	return &llm.LLMResponse{
+		Text:         choice.Message.Content,
+		FinishReason: choice.FinishReason,
+		ToolCalls:    toolCalls,
+		Usage:        qwenResp.Usage.toUsage(),
+	}, nil
+}
+
+// ChatStream sends a streaming chat request to the DashScope API
+func (p *QwenProvider) ChatStream(ctx context.Context, req llm.LLMRequest) (<-chan llm.LLMStreamResponse, error) {
+	httpReq, err := p.newRequest(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &llm.APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	responseChan := make(chan llm.LLMStreamResponse)
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(responseChan)
+
+		send := func(r llm.LLMStreamResponse) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case responseChan <- r:
+				return true
+			}
+		}
+
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				if err != io.EOF {
+					send(llm.LLMStreamResponse{
+						Error: fmt.Sprintf("Error reading stream: %v", err),
+						Done:  true,
+					})
+				} else {
+					send(llm.LLMStreamResponse{Error: llm.StreamIncomplete, Done: true})
+				}
+				return
+			}
+
+			// DashScope events look like "data:{...}", without a space
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+
+			var event QwenChatResponse
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				continue
+			}
+			if event.Code != "" {
+				send(llm.LLMStreamResponse{
+					Error: fmt.Sprintf("Error from API: %s: %s", event.Code, event.Message),
+					Done:  true,
+				})
+				return
+			}
+			if len(event.Output.Choices) == 0 {
+				continue
+			}
+
+			choice := event.Output.Choices[0]
+			// Unfinished events carry the string "null" as finish reason
+			finishReason := choice.FinishReason
+			if finishReason == "null" {
+				finishReason = ""
+			}
+
+			streamResp := llm.LLMStreamResponse{
+				Text:         choice.Message.Content,
+				FinishReason: finishReason,
+				Done:         finishReason != "",
+			}
+			if streamResp.Done {
+				streamResp.Usage = event.Usage.toUsage()
+			}
+			if !send(streamResp) || streamResp.Done {
+				return
+			}
+		}
+	}()
+
+	return responseChan, nil
+}
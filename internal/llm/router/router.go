@@ -0,0 +1,257 @@
+package router
+
+import (
+	"contentive/internal/llm"
+	"contentive/internal/logger"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend is a named provider the router can send requests to
+type Backend struct {
+	Name     string
+	Provider llm.LLMProvider
+}
+
+// Options control retries, timeouts and the circuit breaker of a Router
+type Options struct {
+	MaxRetries       int           // retries on the same backend after the first attempt
+	Backoff          time.Duration // wait before the first retry, doubled for every further retry
+	MaxBackoff       time.Duration // upper bound of the wait, 0 means no bound
+	AttemptTimeout   time.Duration // time a backend gets to answer, or to start a stream; 0 means no limit
+	FailureThreshold int           // consecutive failures that open the breaker of a backend, 0 disables it
+	Cooldown         time.Duration // how long an open breaker rejects requests
+}
+
+// breaker is the circuit breaker of one backend. After FailureThreshold
+// consecutive failures it opens and the backend is skipped until the cooldown
+// has passed. Then a single request is let through: success closes the
+// breaker, failure opens it for another cooldown.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func (b *breaker) allow(options Options) bool {
+	if options.FailureThreshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < options.FailureThreshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	b.failures = 0
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// release frees the probe slot of a request that ended without an answer,
+// so the next request after the cooldown probes the backend again
+func (b *breaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// failure records a failed request and reports whether the breaker opened
+func (b *breaker) failure(options Options) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if options.FailureThreshold > 0 && b.failures >= options.FailureThreshold {
+		b.openUntil = time.Now().Add(options.Cooldown)
+		return true
+	}
+	return false
+}
+
+type backend struct {
+	Backend
+	breaker breaker
+}
+
+// Router is an LLMProvider that sends each request to the first healthy
+// backend in order. Retryable errors are retried on the same backend with
+// exponential backoff before the router fails over to the next one.
+type Router struct {
+	backends []*backend
+	options  Options
+}
+
+// New creates a Router over the backends, in order of preference
+func New(options Options, backends ...Backend) *Router {
+	r := &Router{options: options}
+	for _, b := range backends {
+		r.backends = append(r.backends, &backend{Backend: b})
+	}
+	return r
+}
+
+// route returns the backends to try for a request. A model of the form "name"
+// or "name/model" pins the request to the backend of that name, with the
+// backend's default model or the given one; there is no failover then.
+func (r *Router) route(req llm.LLMRequest) ([]*backend, llm.LLMRequest) {
+	name, model, _ := strings.Cut(req.Model, "/")
+	for _, b := range r.backends {
+		if b.Name == name {
+			req.Model = model
+			return []*backend{b}, req
+		}
+	}
+	return r.backends, req
+}
+
+// attemptFunc makes one call to a provider. It must only use the provider's
+// result after a nil error.
+type attemptFunc func(ctx context.Context, p llm.LLMProvider, req llm.LLMRequest) error
+
+// do runs the call on the backends of the request until one succeeds. It
+// returns the name of that backend and a release function that must be called
+// once the result is no longer used, since it ends the attempt's context.
+func (r *Router) do(ctx context.Context, req llm.LLMRequest, call attemptFunc) (string, context.CancelFunc, error) {
+	backends, req := r.route(req)
+
+	var lastErr error
+	for i, b := range backends {
+		if i > 0 {
+			// Model names are specific to a provider, fallbacks use their own
+			req.Model = ""
+		}
+		if !b.breaker.allow(r.options) {
+			logger.Warning("LLM backend %s skipped, circuit breaker is open", b.Name)
+			continue
+		}
+
+		release, err := r.try(ctx, b, req, call)
+		if err == nil || llm.IsRequestError(err) {
+			// The backend answered, even if it rejected the request
+			b.breaker.success()
+			return b.Name, release, err
+		}
+		if ctx.Err() != nil {
+			// The caller gave up, which says nothing about the backend
+			b.breaker.release()
+			return "", nil, err
+		}
+
+		if b.breaker.failure(r.options) {
+			logger.Warning("LLM backend %s circuit breaker opened for %v", b.Name, r.options.Cooldown)
+		}
+		logger.Warning("LLM backend %s failed: %v", b.Name, err)
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		return "", nil, llm.ErrUnavailable
+	}
+	return "", nil, fmt.Errorf("%w: %v", llm.ErrUnavailable, lastErr)
+}
+
+// try calls one backend, retrying retryable errors. A timed out attempt is not
+// retried, the time is better spent on the next backend.
+func (r *Router) try(ctx context.Context, b *backend, req llm.LLMRequest, call attemptFunc) (context.CancelFunc, error) {
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		var timer *time.Timer
+		if r.options.AttemptTimeout > 0 {
+			timer = time.AfterFunc(r.options.AttemptTimeout, cancel)
+		}
+
+		err := call(attemptCtx, b.Provider, req)
+		timedOut := timer != nil && !timer.Stop()
+		if err == nil {
+			return cancel, nil
+		}
+		cancel()
+
+		if timedOut && ctx.Err() == nil {
+			return nil, fmt.Errorf("no answer within %v: %w", r.options.AttemptTimeout, context.DeadlineExceeded)
+		}
+		if attempt >= r.options.MaxRetries || !llm.IsRetryable(err) {
+			return nil, err
+		}
+
+		delay := r.backoff(attempt)
+		logger.Warning("LLM backend %s failed, retrying in %v: %v", b.Name, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns the wait before the retry following the given attempt
+func (r *Router) backoff(attempt int) time.Duration {
+	delay := r.options.Backoff << attempt
+	if r.options.MaxBackoff > 0 && (delay > r.options.MaxBackoff || delay <= 0) {
+		delay = r.options.MaxBackoff
+	}
+	return delay
+}
+
+// Chat sends a chat request to the first backend that answers
+func (r *Router) Chat(ctx context.Context, req llm.LLMRequest) (*llm.LLMResponse, error) {
+	var resp *llm.LLMResponse
+	name, release, err := r.do(ctx, req, func(ctx context.Context, p llm.LLMProvider, req llm.LLMRequest) error {
+		var err error
+		resp, err = p.Chat(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	release()
+
+	resp.Provider = name
+	return resp, nil
+}
+
+// ChatStream opens a stream on the first backend that answers. Once the stream
+// has started, errors are reported in the stream and there is no failover.
+func (r *Router) ChatStream(ctx context.Context, req llm.LLMRequest) (<-chan llm.LLMStreamResponse, error) {
+	var stream <-chan llm.LLMStreamResponse
+	name, release, err := r.do(ctx, req, func(ctx context.Context, p llm.LLMProvider, req llm.LLMRequest) error {
+		var err error
+		stream, err = p.ChatStream(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	responseChan := make(chan llm.LLMStreamResponse)
+
+	go func() {
+		defer release()
+		defer close(responseChan)
+
+		for resp := range stream {
+			resp.Provider = name
+			select {
+			case <-ctx.Done():
+				return
+			case responseChan <- resp:
+			}
+		}
+	}()
+
+	return responseChan, nil
+}
@@ -0,0 +1,466 @@
+package router
+
+import (
+	"contentive/internal/llm"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProvider returns the scripted errors in order, then succeeds
+type fakeProvider struct {
+	mu     sync.Mutex
+	errs   []error
+	block  bool // wait for the context to end instead of answering
+	models []string
+}
+
+func (p *fakeProvider) next(ctx context.Context, req llm.LLMRequest) error {
+	p.mu.Lock()
+	p.models = append(p.models, req.Model)
+	var err error
+	if len(p.errs) > 0 {
+		err, p.errs = p.errs[0], p.errs[1:]
+	}
+	p.mu.Unlock()
+
+	if p.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return err
+}
+
+func (p *fakeProvider) calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.models)
+}
+
+func (p *fakeProvider) Chat(ctx context.Context, req llm.LLMRequest) (*llm.LLMResponse, error) {
+	if err := p.next(ctx, req); err != nil {
+		return nil, err
+	}
+	return &llm.LLMResponse{Text: "ok"}, nil
+}
+
+func (p *fakeProvider) ChatStream(ctx context.Context, req llm.LLMRequest) (<-chan llm.LLMStreamResponse, error) {
+	if err := p.next(ctx, req); err != nil {
+		return nil, err
+	}
+	stream := make(chan llm.LLMStreamResponse)
+	go func() {
+		defer close(stream)
+		for _, resp := range []llm.LLMStreamResponse{{Text: "o"}, {Text: "k", Done: true}} {
+			select {
+			case <-ctx.Done():
+				return
+			case stream <- resp:
+			}
+		}
+	}()
+	return stream, nil
+}
+
+func apiError(status int) error {
+	return &llm.APIError{StatusCode: status}
+}
+
+func TestChatRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error
+		retries   int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success", nil, 2, 1, false},
+		{"server errors then success", []error{apiError(503), apiError(500)}, 2, 3, false},
+		{"rate limit then success", []error{apiError(429)}, 1, 2, false},
+		{"network error then success", []error{&timeoutError{}}, 1, 2, false},
+		{"retries exhausted", []error{apiError(502), apiError(502), apiError(502)}, 2, 3, true},
+		{"no retries", []error{apiError(503)}, 0, 1, true},
+		{"not retryable", []error{apiError(401)}, 2, 1, true},
+		{"request error", []error{apiError(400)}, 2, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakeProvider{errs: tt.errs}
+			r := New(Options{MaxRetries: tt.retries, Backoff: time.Millisecond}, Backend{Name: "primary", Provider: p})
+
+			resp, err := r.Chat(context.Background(), llm.LLMRequest{Prompt: "hi"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && resp.Provider != "primary" {
+				t.Errorf("got provider %q, want primary", resp.Provider)
+			}
+			if p.calls() != tt.wantCalls {
+				t.Errorf("got %d calls, want %d", p.calls(), tt.wantCalls)
+			}
+		})
+	}
+}
+
+// timeoutError is a network error
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		options Options
+		attempt int
+		want    time.Duration
+	}{
+		{Options{Backoff: 100 * time.Millisecond}, 0, 100 * time.Millisecond},
+		{Options{Backoff: 100 * time.Millisecond}, 1, 200 * time.Millisecond},
+		{Options{Backoff: 100 * time.Millisecond}, 3, 800 * time.Millisecond},
+		{Options{Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}, 2, 300 * time.Millisecond},
+		{Options{Backoff: time.Second, MaxBackoff: 10 * time.Second}, 62, 10 * time.Second}, // overflows
+		{Options{}, 4, 0},
+	}
+
+	for _, tt := range tests {
+		r := New(tt.options)
+		if got := r.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) with %+v: got %v, want %v", tt.attempt, tt.options, got, tt.want)
+		}
+	}
+}
+
+func TestRetryWaitsForBackoff(t *testing.T) {
+	p := &fakeProvider{errs: []error{apiError(503), apiError(503)}}
+	r := New(Options{MaxRetries: 2, Backoff: 20 * time.Millisecond}, Backend{Name: "primary", Provider: p})
+
+	start := time.Now()
+	if _, err := r.Chat(context.Background(), llm.LLMRequest{Prompt: "hi"}); err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	// 20ms before the first retry and 40ms before the second
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("retries took %v, want at least 60ms", elapsed)
+	}
+}
+
+func TestRetryStopsWhenCancelled(t *testing.T) {
+	p := &fakeProvider{errs: []error{apiError(503), apiError(503)}}
+	r := New(Options{MaxRetries: 2, Backoff: time.Hour}, Backend{Name: "primary", Provider: p})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.Chat(ctx, llm.LLMRequest{Prompt: "hi"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if p.calls() != 1 {
+		t.Errorf("got %d calls, want 1", p.calls())
+	}
+}
+
+func TestFailover(t *testing.T) {
+	tests := []struct {
+		name          string
+		primaryErrs   []error
+		wantProvider  string
+		wantPrimary   int
+		wantFallback  int
+		wantAPIStatus int
+	}{
+		{"primary answers", nil, "primary", 1, 0, 0},
+		{"primary down", []error{apiError(500), apiError(500)}, "fallback", 2, 1, 0},
+		{"primary unauthorized", []error{apiError(401)}, "fallback", 1, 1, 0},
+		{"request rejected", []error{apiError(400)}, "", 1, 0, 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &fakeProvider{errs: tt.primaryErrs}
+			fallback := &fakeProvider{}
+			r := New(Options{MaxRetries: 1, Backoff: time.Millisecond},
+				Backend{Name: "primary", Provider: primary},
+				Backend{Name: "fallback", Provider: fallback},
+			)
+
+			resp, err := r.Chat(context.Background(), llm.LLMRequest{Prompt: "hi", Model: "gpt-4o"})
+			if tt.wantAPIStatus != 0 {
+				var apiErr *llm.APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantAPIStatus {
+					t.Fatalf("got error %v, want API error %d", err, tt.wantAPIStatus)
+				}
+				if errors.Is(err, llm.ErrUnavailable) {
+					t.Error("a rejected request must not be reported as unavailable")
+				}
+			} else if err != nil {
+				t.Fatalf("Chat: %v", err)
+			} else if resp.Provider != tt.wantProvider {
+				t.Errorf("got provider %q, want %q", resp.Provider, tt.wantProvider)
+			}
+
+			if primary.calls() != tt.wantPrimary || fallback.calls() != tt.wantFallback {
+				t.Errorf("got %d primary and %d fallback calls, want %d and %d",
+					primary.calls(), fallback.calls(), tt.wantPrimary, tt.wantFallback)
+			}
+			if primary.calls() > 0 && primary.models[0] != "gpt-4o" {
+				t.Errorf("primary got model %q, want gpt-4o", primary.models[0])
+			}
+			if fallback.calls() > 0 && fallback.models[0] != "" {
+				t.Errorf("fallback got model %q, want its default", fallback.models[0])
+			}
+		})
+	}
+}
+
+func TestAllBackendsDown(t *testing.T) {
+	r := New(Options{},
+		Backend{Name: "primary", Provider: &fakeProvider{errs: []error{apiError(500)}}},
+		Backend{Name: "fallback", Provider: &fakeProvider{errs: []error{apiError(503)}}},
+	)
+
+	_, err := r.Chat(context.Background(), llm.LLMRequest{Prompt: "hi"})
+	if !errors.Is(err, llm.ErrUnavailable) {
+		t.Fatalf("got error %v, want ErrUnavailable", err)
+	}
+	if !strings.Contains(err.Error(), "status 503") {
+		t.Errorf("got error %v, want it to report the last error", err)
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	primary := &fakeProvider{block: true}
+	fallback := &fakeProvider{}
+	r := New(Options{MaxRetries: 2, Backoff: time.Millisecond, AttemptTimeout: 20 * time.Millisecond},
+		Backend{Name: "primary", Provider: primary},
+		Backend{Name: "fallback", Provider: fallback},
+	)
+
+	resp, err := r.Chat(context.Background(), llm.LLMRequest{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if resp.Provider != "fallback" {
+		t.Errorf("got provider %q, want fallback", resp.Provider)
+	}
+	// A timed out attempt is not retried
+	if primary.calls() != 1 {
+		t.Errorf("got %d primary calls, want 1", primary.calls())
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	primary := &fakeProvider{}
+	fallback := &fakeProvider{}
+	r := New(Options{FailureThreshold: 2, Cooldown: 50 * time.Millisecond},
+		Backend{Name: "primary", Provider: primary},
+		Backend{Name: "fallback", Provider: fallback},
+	)
+	chat := func() string {
+		t.Helper()
+		resp, err := r.Chat(context.Background(), llm.LLMRequest{Prompt: "hi"})
+		if err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+		return resp.Provider
+	}
+
+	// Two failures in a row open the breaker
+	primary.errs = []error{apiError(500), apiError(500)}
+	chat()
+	chat()
+	if got := chat(); got != "fallback" || primary.calls() != 2 {
+		t.Fatalf("open breaker: got provider %q after %d primary calls, want fallback after 2", got, primary.calls())
+	}
+
+	// After the cooldown a failed probe opens it again
+	time.Sleep(60 * time.Millisecond)
+	primary.errs = []error{apiError(500)}
+	if got := chat(); got != "fallback" || primary.calls() != 3 {
+		t.Fatalf("failed probe: got provider %q after %d primary calls, want fallback after 3", got, primary.calls())
+	}
+	if got := chat(); got != "fallback" || primary.calls() != 3 {
+		t.Fatalf("reopened breaker: got provider %q after %d primary calls, want fallback after 3", got, primary.calls())
+	}
+
+	// A successful probe closes it
+	time.Sleep(60 * time.Millisecond)
+	if got := chat(); got != "primary" {
+		t.Fatalf("successful probe: got provider %q, want primary", got)
+	}
+	if got := chat(); got != "primary" || primary.calls() != 5 {
+		t.Fatalf("closed breaker: got provider %q after %d primary calls, want primary after 5", got, primary.calls())
+	}
+}
+
+func TestBreakerHalfOpenLetsOneProbeThrough(t *testing.T) {
+	options := Options{FailureThreshold: 1, Cooldown: 10 * time.Millisecond}
+	var b breaker
+
+	if !b.allow(options) {
+		t.Fatal("closed breaker must allow requests")
+	}
+	if !b.failure(options) {
+		t.Fatal("breaker must open at the threshold")
+	}
+	if b.allow(options) {
+		t.Fatal("open breaker must reject requests")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if !b.allow(options) {
+		t.Fatal("breaker must let a probe through after the cooldown")
+	}
+	if b.allow(options) {
+		t.Fatal("breaker must let a single probe through")
+	}
+	b.success()
+	if !b.allow(options) || !b.allow(options) {
+		t.Fatal("breaker must close after a successful probe")
+	}
+}
+
+func TestBreakerProbeCancelled(t *testing.T) {
+	p := &fakeProvider{errs: []error{apiError(http.StatusServiceUnavailable)}}
+	r := New(Options{FailureThreshold: 1, Cooldown: 10 * time.Millisecond}, Backend{Name: "primary", Provider: p})
+
+	if _, err := r.Chat(context.Background(), llm.LLMRequest{}); err == nil {
+		t.Fatal("first request must fail")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// The caller gives up during the half-open probe
+	p.block = true
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.Chat(ctx, llm.LLMRequest{}); err == nil {
+		t.Fatal("cancelled probe must fail")
+	}
+	p.block = false
+
+	if _, err := r.Chat(context.Background(), llm.LLMRequest{}); err != nil {
+		t.Fatalf("backend must be probed again after a cancelled probe: %v", err)
+	}
+	if calls := p.calls(); calls != 3 {
+		t.Errorf("got %d calls, want 3", calls)
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	options := Options{}
+	var b breaker
+	for i := 0; i < 10; i++ {
+		if b.failure(options) {
+			t.Fatal("disabled breaker must not open")
+		}
+	}
+	if !b.allow(options) {
+		t.Fatal("disabled breaker must allow requests")
+	}
+}
+
+func TestNamedRoutes(t *testing.T) {
+	tests := []struct {
+		model        string
+		wantProvider string
+		wantModel    string
+	}{
+		{"", "primary", ""},
+		{"gpt-4o", "primary", "gpt-4o"},
+		{"backup", "backup", ""},
+		{"backup/llama3.1", "backup", "llama3.1"},
+		{"primary/gpt-4o-mini", "primary", "gpt-4o-mini"},
+		{"unknown/model", "primary", "unknown/model"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			providers := map[string]*fakeProvider{"primary": {}, "backup": {}}
+			r := New(Options{},
+				Backend{Name: "primary", Provider: providers["primary"]},
+				Backend{Name: "backup", Provider: providers["backup"]},
+			)
+
+			resp, err := r.Chat(context.Background(), llm.LLMRequest{Prompt: "hi", Model: tt.model})
+			if err != nil {
+				t.Fatalf("Chat: %v", err)
+			}
+			if resp.Provider != tt.wantProvider {
+				t.Errorf("got provider %q, want %q", resp.Provider, tt.wantProvider)
+			}
+			p := providers[tt.wantProvider]
+			if p.calls() != 1 || p.models[0] != tt.wantModel {
+				t.Errorf("got models %q, want [%q]", p.models, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestNamedRouteHasNoFailover(t *testing.T) {
+	primary := &fakeProvider{}
+	backup := &fakeProvider{errs: []error{apiError(500)}}
+	r := New(Options{},
+		Backend{Name: "primary", Provider: primary},
+		Backend{Name: "backup", Provider: backup},
+	)
+
+	_, err := r.Chat(context.Background(), llm.LLMRequest{Prompt: "hi", Model: "backup"})
+	if !errors.Is(err, llm.ErrUnavailable) {
+		t.Fatalf("got error %v, want ErrUnavailable", err)
+	}
+	if primary.calls() != 0 {
+		t.Errorf("got %d primary calls, want none", primary.calls())
+	}
+}
+
+func TestChatStream(t *testing.T) {
+	primary := &fakeProvider{errs: []error{apiError(http.StatusServiceUnavailable)}}
+	fallback := &fakeProvider{}
+	r := New(Options{},
+		Backend{Name: "primary", Provider: primary},
+		Backend{Name: "fallback", Provider: fallback},
+	)
+
+	stream, err := r.ChatStream(context.Background(), llm.LLMRequest{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	var text string
+	for resp := range stream {
+		if resp.Provider != "fallback" {
+			t.Errorf("got provider %q, want fallback", resp.Provider)
+		}
+		text += resp.Text
+	}
+	if text != "ok" {
+		t.Errorf("got text %q, want ok", text)
+	}
+}
+
+func TestChatStreamCancel(t *testing.T) {
+	r := New(Options{}, Backend{Name: "primary", Provider: &fakeProvider{}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := r.ChatStream(ctx, llm.LLMRequest{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	cancel()
+
+	// The stream closes once the request is cancelled, even if it is not read
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-stream:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("stream was not closed after cancel")
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package llm
+
+import "unicode"
+
+// messageOverheadTokens approximates the tokens a chat format adds per message
+const messageOverheadTokens = 4
+
+// EstimateTokens approximates the number of tokens in text without a tokenizer.
+// CJK characters count as one token each and other text as one token per four
+// characters, which errs on the side of overestimating for most models.
+func EstimateTokens(text string) int {
+	tokens := 0
+	other := 0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			tokens++
+		} else {
+			other++
+		}
+	}
+	return tokens + (other+3)/4
+}
+
+// EstimateMessageTokens approximates the number of tokens of a message list
+func EstimateMessageTokens(messages []Message) int {
+	tokens := 0
+	for _, message := range messages {
+		tokens += EstimateTokens(message.Content) + messageOverheadTokens
+	}
+	return tokens
+}
+
+// EstimateUsage approximates the usage of a request and its reply, for
+// providers that do not report it
+func EstimateUsage(req LLMRequest, reply string) *Usage {
+	usage := &Usage{
+		PromptTokens:     EstimateMessageTokens(req.ChatMessages()),
+		CompletionTokens: EstimateTokens(reply),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// TruncateMessages drops the oldest messages until the conversation fits in
+// budget tokens. Leading system messages and the last message are always kept,
+// so the result may still exceed a budget that is too small for them.
+func TruncateMessages(messages []Message, budget int) []Message {
+	if budget <= 0 || EstimateMessageTokens(messages) <= budget {
+		return messages
+	}
+
+	system := 0
+	for system < len(messages) && messages[system].Role == RoleSystem {
+		system++
+	}
+	if system == len(messages) {
+		return messages
+	}
+
+	used := EstimateMessageTokens(messages[:system])
+	// Walk back from the newest message while the history still fits
+	start := len(messages) - 1
+	used += EstimateMessageTokens(messages[start:])
+	for start > system {
+		cost := EstimateMessageTokens(messages[start-1 : start])
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		start--
+	}
+
+	truncated := make([]Message, 0, system+len(messages)-start)
+	truncated = append(truncated, messages[:system]...)
+	truncated = append(truncated, messages[start:]...)
+	return truncated
+}
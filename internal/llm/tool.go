@@ -0,0 +1,122 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// DefaultMaxToolRounds bounds how many times the model may call tools before it has to answer
+const DefaultMaxToolRounds = 5
+
+// Tool choices
+const (
+	ToolChoiceAuto = "auto" // the model decides whether to call tools
+	ToolChoiceNone = "none" // the model must answer without calling tools
+)
+
+// Tool describes a function the model may call
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"` // JSON schema of the arguments
+}
+
+// ToolCall is a call of a tool requested by the model
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`        // JSON encoded arguments
+	Result    string `json:"result,omitempty"` // set once the call has been executed
+}
+
+// ToolFunc executes a tool call with its JSON encoded arguments and returns the result
+type ToolFunc func(ctx context.Context, arguments string) (string, error)
+
+// ToolBox holds tool definitions together with their implementations
+type ToolBox struct {
+	Tools []Tool
+	funcs map[string]ToolFunc
+}
+
+// NewToolBox creates an empty ToolBox
+func NewToolBox() *ToolBox {
+	return &ToolBox{funcs: make(map[string]ToolFunc)}
+}
+
+// Add registers a tool
+func (b *ToolBox) Add(tool Tool, fn ToolFunc) {
+	b.Tools = append(b.Tools, tool)
+	b.funcs[tool.Name] = fn
+}
+
+// Call executes a tool call. Failures are returned as a JSON error result so
+// the model can see them and correct itself.
+func (b *ToolBox) Call(ctx context.Context, call ToolCall) string {
+	fn, ok := b.funcs[call.Name]
+	if !ok {
+		return toolError(fmt.Errorf("unknown tool '%s'", call.Name))
+	}
+	result, err := fn(ctx, call.Arguments)
+	if err != nil {
+		return toolError(err)
+	}
+	return result
+}
+
+func toolError(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
+
+// ChatWithTools runs the tool calling loop: the tools requested by the model
+// are executed and their results sent back until the model answers without
+// calling tools. After maxRounds rounds the model is asked to answer without
+// tools. The response lists every executed call with its result.
+func ChatWithTools(ctx context.Context, p LLMProvider, req LLMRequest, box *ToolBox, maxRounds int) (*LLMResponse, error) {
+	if maxRounds <= 0 {
+		maxRounds = DefaultMaxToolRounds
+	}
+
+	req.Messages = req.ChatMessages()
+	req.Prompt = ""
+	req.Stream = false
+	req.Tools = box.Tools
+
+	var executed []ToolCall
+	usage := &Usage{}
+	for round := 0; ; round++ {
+		if round == maxRounds {
+			req.ToolChoice = ToolChoiceNone
+		}
+
+		resp, err := p.Chat(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		usage.Add(resp.Usage)
+		if len(resp.ToolCalls) == 0 || round == maxRounds {
+			resp.ToolCalls = executed
+			if resp.Usage != nil {
+				// Report the tokens of every round
+				resp.Usage = usage
+			}
+			return resp, nil
+		}
+
+		req.Messages = append(req.Messages, Message{
+			Role:      RoleAssistant,
+			Content:   resp.Text,
+			ToolCalls: resp.ToolCalls,
+		})
+		for _, call := range resp.ToolCalls {
+			call.Result = box.Call(ctx, call)
+			executed = append(executed, call)
+			req.Messages = append(req.Messages, Message{
+				Role:       RoleTool,
+				Content:    call.Result,
+				ToolCallID: call.ID,
+			})
+		}
+	}
+}
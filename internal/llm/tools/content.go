@@ -0,0 +1,256 @@
+// Package tools provides built-in LLM tools that let the model read CMS content
+// on behalf of an API user.
+package tools
+
+import (
+	"contentive/internal/database"
+	"contentive/internal/llm"
+	"contentive/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultListLimit = 5
+	maxListLimit     = 20
+)
+
+// ContentTools returns the content tools for an API user. Every tool only
+// reaches schemas the user holds the {schema}:read scope for, and only
+// published content is returned.
+func ContentTools(apiUser models.APIUser) *llm.ToolBox {
+	t := &contentTools{apiUser: apiUser}
+
+	box := llm.NewToolBox()
+	box.Add(llm.Tool{
+		Name:        "list_schemas",
+		Description: "List the content schemas that can be read, with their fields.",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	}, t.listSchemas)
+	box.Add(llm.Tool{
+		Name:        "list_content",
+		Description: "List published content entries of a schema, newest first by default.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"schema": map[string]interface{}{
+					"type":        "string",
+					"description": "Slug of the schema",
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Number of entries to return, at most %d", maxListLimit),
+				},
+				"order_by": map[string]interface{}{
+					"type": "string",
+					"enum": []string{"published_at", "created_at", "updated_at", "slug"},
+				},
+				"order": map[string]interface{}{
+					"type": "string",
+					"enum": []string{"asc", "desc"},
+				},
+			},
+			"required": []string{"schema"},
+		},
+	}, t.listContent)
+	box.Add(llm.Tool{
+		Name:        "get_content",
+		Description: "Get a published content entry of a schema by its slug.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"schema": map[string]interface{}{
+					"type":        "string",
+					"description": "Slug of the schema",
+				},
+				"slug": map[string]interface{}{
+					"type":        "string",
+					"description": "Slug of the content entry",
+				},
+			},
+			"required": []string{"schema", "slug"},
+		},
+	}, t.getContent)
+	return box
+}
+
+type contentTools struct {
+	apiUser models.APIUser
+}
+
+// schemaField is the part of a field definition shown to the model
+type schemaField struct {
+	Name     string           `json:"name"`
+	Type     models.FieldType `json:"type"`
+	Required bool             `json:"required"`
+}
+
+// contentResult is a content entry as returned to the model
+type contentResult struct {
+	Slug        string                 `json:"slug"`
+	Data        map[string]interface{} `json:"data"`
+	PublishedAt *time.Time             `json:"published_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+// readableSchema loads a schema by slug if the API user may read it, as
+// RequireSchemaScope would check it
+func (t *contentTools) readableSchema(ctx context.Context, slug string) (*models.Schema, error) {
+	if slug == "" {
+		return nil, errors.New("schema is required")
+	}
+	if !t.apiUser.HasScope(slug + ":read") {
+		return nil, fmt.Errorf("no permission to read schema '%s'", slug)
+	}
+
+	var schema models.Schema
+	if err := database.DB.WithContext(ctx).Where("slug = ?", slug).First(&schema).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("schema '%s' not found", slug)
+		}
+		return nil, fmt.Errorf("failed to fetch schema: %v", err)
+	}
+	return &schema, nil
+}
+
+func (t *contentTools) listSchemas(ctx context.Context, _ string) (string, error) {
+	var schemas []models.Schema
+	if err := database.DB.WithContext(ctx).Order("slug").Find(&schemas).Error; err != nil {
+		return "", fmt.Errorf("failed to fetch schemas: %v", err)
+	}
+
+	type schemaResult struct {
+		Slug   string        `json:"slug"`
+		Name   string        `json:"name"`
+		Type   string        `json:"type"`
+		Fields []schemaField `json:"fields"`
+	}
+	results := []schemaResult{}
+	for _, schema := range schemas {
+		if !t.apiUser.HasScope(schema.Slug + ":read") {
+			continue
+		}
+		var fields []models.FieldDefinition
+		if err := json.Unmarshal(schema.Fields, &fields); err != nil {
+			return "", fmt.Errorf("failed to read fields of schema '%s'", schema.Slug)
+		}
+		result := schemaResult{Slug: schema.Slug, Name: schema.Name, Type: string(schema.Type), Fields: []schemaField{}}
+		for _, field := range fields {
+			if field.Type == models.FieldTypePassword {
+				continue
+			}
+			result.Fields = append(result.Fields, schemaField{Name: field.Name, Type: field.Type, Required: field.Required})
+		}
+		results = append(results, result)
+	}
+	return marshal(results)
+}
+
+func (t *contentTools) listContent(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Schema  string `json:"schema"`
+		Limit   int    `json:"limit"`
+		OrderBy string `json:"order_by"`
+		Order   string `json:"order"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+
+	schema, err := t.readableSchema(ctx, args.Schema)
+	if err != nil {
+		return "", err
+	}
+
+	if args.Limit <= 0 {
+		args.Limit = defaultListLimit
+	} else if args.Limit > maxListLimit {
+		args.Limit = maxListLimit
+	}
+	allowedOrderBy := map[string]bool{"published_at": true, "created_at": true, "updated_at": true, "slug": true}
+	if !allowedOrderBy[args.OrderBy] {
+		args.OrderBy = "published_at"
+	}
+	if args.Order != "asc" {
+		args.Order = "desc"
+	}
+
+	var entries []models.ContentEntry
+	if err := database.DB.WithContext(ctx).
+		Where("content_type_id = ? AND is_published = ?", schema.ID, true).
+		Order(fmt.Sprintf("%s %s NULLS LAST", args.OrderBy, args.Order)).
+		Limit(args.Limit).
+		Find(&entries).Error; err != nil {
+		return "", fmt.Errorf("failed to fetch content: %v", err)
+	}
+
+	results := []contentResult{}
+	for _, entry := range entries {
+		results = append(results, toContentResult(*schema, entry))
+	}
+	return marshal(results)
+}
+
+func (t *contentTools) getContent(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Schema string `json:"schema"`
+		Slug   string `json:"slug"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+
+	schema, err := t.readableSchema(ctx, args.Schema)
+	if err != nil {
+		return "", err
+	}
+
+	var entry models.ContentEntry
+	if err := database.DB.WithContext(ctx).
+		Where("content_type_id = ? AND slug = ? AND is_published = ?", schema.ID, args.Slug, true).
+		First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("content '%s' not found", args.Slug)
+		}
+		return "", fmt.Errorf("failed to fetch content: %v", err)
+	}
+
+	return marshal(toContentResult(*schema, entry))
+}
+
+// toContentResult converts an entry for the model, leaving out password fields
+func toContentResult(schema models.Schema, entry models.ContentEntry) contentResult {
+	var data map[string]interface{}
+	json.Unmarshal(entry.Data, &data)
+
+	var fields []models.FieldDefinition
+	json.Unmarshal(schema.Fields, &fields)
+	for _, field := range fields {
+		if field.Type == models.FieldTypePassword {
+			delete(data, field.Name)
+		}
+	}
+
+	return contentResult{
+		Slug:        entry.Slug,
+		Data:        data,
+		PublishedAt: entry.PublishedAt,
+		UpdatedAt:   entry.UpdatedAt,
+	}
+}
+
+func marshal(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode result: %v", err)
+	}
+	return string(data), nil
+}
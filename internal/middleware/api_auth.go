@@ -75,15 +75,7 @@ func RequireAPIScope(requiredScope string) fiber.Handler {
 		}
 
 		// Check if the API user has the required scope
-		hasScope := false
-		for _, scope := range apiUser.Scopes {
-			if scope == requiredScope || scope == "*" {
-				hasScope = true
-				break
-			}
-		}
-
-		if !hasScope {
+		if !apiUser.HasScope(requiredScope) {
 			logger.Error("API user does not have the required scope: %s", requiredScope)
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 				"error": "Insufficient permissions",
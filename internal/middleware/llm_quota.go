@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"contentive/internal/database"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// EnforceLLMQuota rejects requests of API users that have used up their daily
+// or monthly LLM token quota, with 429 and the seconds until the quota resets.
+// Usage is checked before the call, so the request that crosses a quota is
+// still served. Reads (GET and HEAD) never call the model and are not limited.
+func EnforceLLMQuota() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+			return c.Next()
+		}
+
+		apiUser, ok := c.Locals("user").(models.APIUser)
+		if !ok {
+			logger.Error("User is not an API user")
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "User is not an API user",
+			})
+		}
+
+		now := time.Now().UTC()
+		// The monthly quota goes first, it resets later if both are used up
+		quotas := []struct {
+			name  string
+			limit int64
+			start time.Time
+			reset time.Time
+		}{
+			{"Monthly", apiUser.MonthlyTokenQuota, models.StartOfMonth(now), models.StartOfMonth(now).AddDate(0, 1, 0)},
+			{"Daily", apiUser.DailyTokenQuota, models.StartOfDay(now), models.StartOfDay(now).AddDate(0, 0, 1)},
+		}
+
+		for _, quota := range quotas {
+			if quota.limit <= 0 {
+				continue
+			}
+
+			used, err := models.SumLLMTokens(database.DB, apiUser.ID, quota.start)
+			if err != nil {
+				logger.Error("Failed to get LLM usage: %v", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to check token quota",
+				})
+			}
+
+			if used >= quota.limit {
+				logger.Error("API user %s exceeded the %s token quota", apiUser.Name, strings.ToLower(quota.name))
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(quota.reset.Sub(now).Seconds()))))
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+					"error":    quota.name + " token quota exceeded",
+					"quota":    quota.limit,
+					"used":     used,
+					"reset_at": quota.reset,
+				})
+			}
+		}
+
+		return c.Next()
+	}
+}
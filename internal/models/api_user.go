@@ -35,6 +35,9 @@ type APIUser struct {
 	UpdatedAt   time.Time      `json:"updated_at"`
 	Scopes      pq.StringArray `json:"scopes" gorm:"type:text[]"`
 	Status      APIUserStatus  `json:"status"`
+	// LLM token quotas, 0 means unlimited
+	DailyTokenQuota   int64 `json:"daily_token_quota" gorm:"not null;default:0"`
+	MonthlyTokenQuota int64 `json:"monthly_token_quota" gorm:"not null;default:0"`
 }
 
 // Claims is a struct that contains the claims for the JWT token
@@ -83,6 +86,17 @@ func (u *APIUser) BeforeCreate(*gorm.DB) error {
 	return nil
 }
 
+// HasScope reports whether the API user has been granted the given scope,
+// either explicitly or through the "*" wildcard
+func (u *APIUser) HasScope(scope string) bool {
+	for _, s := range u.Scopes {
+		if s == scope || s == "*" {
+			return true
+		}
+	}
+	return false
+}
+
 var Secret string
 
 func SetSecret(secret string) {
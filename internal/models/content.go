@@ -18,11 +18,11 @@ const (
 type ContentEntry struct {
 	ID             uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
 	Slug           string                 `json:"slug" gorm:"unique;not null"`
-	ContentTypeID  uuid.UUID              `json:"content_type_id" gorm:"type:uuid;not null"`
-	Data           datatypes.JSON         `json:"data" gorm:"type:jsonb"`
+	ContentTypeID  uuid.UUID              `json:"content_type_id" gorm:"type:uuid;not null;index:idx_content_entry_created,priority:1"`
+	Data           datatypes.JSON         `json:"data" gorm:"type:jsonb;index:idx_content_entry_data,type:gin"` // GIN index for the data filters
 	IsPublished    bool                   `json:"is_published" gorm:"default:false"`
 	PublishedAt    *time.Time             `json:"published_at"`
-	CreatedAt      time.Time              `json:"created_at" gorm:"autoCreateTime"`
+	CreatedAt      time.Time              `json:"created_at" gorm:"autoCreateTime;index:idx_content_entry_created,priority:2"` // the default order of content listings
 	UpdatedAt      time.Time              `json:"updated_at" gorm:"autoUpdateTime"`
 	PublishedBy    *uuid.UUID             `json:"published_by" gorm:"type:uuid"`
 	CreatedByType  ContentEntryUserByType `json:"created_by_type" gorm:"not null"`
@@ -31,6 +31,9 @@ type ContentEntry struct {
 	CurrentVersion int                    `json:"current_version" gorm:"default:1"`
 	Versions       []ContentVersion       `json:"versions,omitempty" gorm:"foreignKey:ContentEntryID"`
 	Status         string                 `json:"status" gorm:"type:varchar(20);default:'draft'"`
+	PublishAt      *time.Time             `json:"publish_at" gorm:"index:idx_content_entry_publish_at,where:publish_at IS NOT NULL"`       // pending scheduled publish
+	UnpublishAt    *time.Time             `json:"unpublish_at" gorm:"index:idx_content_entry_unpublish_at,where:unpublish_at IS NOT NULL"` // pending scheduled unpublish
+	ScheduledBy    *uuid.UUID             `json:"scheduled_by" gorm:"type:uuid"`                                                           // admin who set the schedule, publisher of the scheduled publish
 }
 
 // ContentVersion represents a version of a content entry
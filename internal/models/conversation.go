@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Conversation is a persistent chat thread owned by an API user
+type Conversation struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	APIUserID uuid.UUID `json:"api_user_id" gorm:"type:uuid;not null;index"`
+	Title     string    `json:"title" gorm:"type:varchar(255)"`
+	System    string    `json:"system" gorm:"type:text"`        // system prompt sent before the history
+	Model     string    `json:"model" gorm:"type:varchar(255)"` // overrides the provider's default model
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	Messages  []Message `json:"messages,omitempty" gorm:"foreignKey:ConversationID;constraint:OnDelete:CASCADE"`
+}
+
+// Message is one turn of a conversation
+type Message struct {
+	ID             uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	ConversationID uuid.UUID `json:"conversation_id" gorm:"type:uuid;not null;index"`
+	Role           string    `json:"role" gorm:"type:varchar(20);not null"` // user or assistant
+	Content        string    `json:"content" gorm:"type:text;not null"`
+	FinishReason   string    `json:"finish_reason,omitempty" gorm:"type:varchar(50)"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Vector is a pgvector value, stored in the text form "[0.1,0.2,...]"
+type Vector []float32
+
+// GormDataType tells GORM to use the pgvector column type
+func (Vector) GormDataType() string {
+	return "vector"
+}
+
+// Value implements driver.Valuer
+func (v Vector) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return v.String(), nil
+}
+
+// Scan implements sql.Scanner
+func (v *Vector) Scan(src interface{}) error {
+	var str string
+	switch s := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case string:
+		str = s
+	case []byte:
+		str = string(s)
+	default:
+		return fmt.Errorf("cannot scan %T into Vector", src)
+	}
+
+	str = strings.TrimSpace(str)
+	str = strings.TrimPrefix(str, "[")
+	str = strings.TrimSuffix(str, "]")
+	if str == "" {
+		*v = Vector{}
+		return nil
+	}
+
+	parts := strings.Split(str, ",")
+	vec := make(Vector, len(parts))
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return fmt.Errorf("invalid vector component %q: %v", part, err)
+		}
+		vec[i] = float32(f)
+	}
+	*v = vec
+	return nil
+}
+
+// String returns the pgvector text representation of the vector
+func (v Vector) String() string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, f := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(f), 'f', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// ContentEmbedding is a chunk of published content together with its embedding,
+// used for retrieval augmented generation
+type ContentEmbedding struct {
+	ID               uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	ContentEntryID   uuid.UUID  `json:"content_entry_id" gorm:"type:uuid;not null;index"`
+	SchemaID         uuid.UUID  `json:"schema_id" gorm:"type:uuid;not null;index"`
+	ContentVersionID *uuid.UUID `json:"content_version_id" gorm:"type:uuid;index"` // version the chunk was taken from
+	Version          int        `json:"version" gorm:"not null"`
+	ChunkIndex       int        `json:"chunk_index" gorm:"not null"`
+	Field            string     `json:"field" gorm:"type:varchar(255);not null;default:''"` // field the chunk was taken from
+	Content          string     `json:"content" gorm:"type:text;not null"`
+	Model            string     `json:"model" gorm:"type:varchar(255);not null;index"` // embedding model that produced the vector
+	Weight           float64    `json:"weight" gorm:"not null;default:1"`              // multiplies the similarity of the chunk
+	Embedding        Vector     `json:"-" gorm:"not null"`
+	CreatedAt        time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// ContentIndexState records what the knowledge index holds for a content entry,
+// so that unchanged entries are not embedded again
+type ContentIndexState struct {
+	ContentEntryID   uuid.UUID  `json:"content_entry_id" gorm:"type:uuid;primaryKey"`
+	SchemaID         uuid.UUID  `json:"schema_id" gorm:"type:uuid;not null;index"`
+	ContentVersionID *uuid.UUID `json:"content_version_id" gorm:"type:uuid"`
+	Version          int        `json:"version"`
+	ContentHash      string     `json:"content_hash" gorm:"type:varchar(64)"` // hash of the indexed text and model
+	Model            string     `json:"model" gorm:"type:varchar(255)"`
+	ChunkCount       int        `json:"chunk_count"`
+	IndexedAt        *time.Time `json:"indexed_at"` // last time the entry was embedded
+	SyncedAt         time.Time  `json:"synced_at"`  // last time the entry was checked against the index
+	Error            string     `json:"error" gorm:"type:text"`
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	DefaultIndexChunkSize    = 1000 // characters per chunk
+	DefaultIndexChunkOverlap = 200  // characters shared by consecutive chunks
+	MaxIndexChunkSize        = 8000
+	MaxIndexWeight           = 10
+	MaxIndexPrefixLength     = 100
+)
+
+// FieldIndexOptions controls how a field is embedded for retrieval. They are
+// read from the "index" option of a field, which is either a boolean or an
+// object such as {"include": true, "chunkSize": 500, "weight": 2}.
+type FieldIndexOptions struct {
+	Include      bool    `json:"include"`
+	ChunkSize    int     `json:"chunkSize"`
+	ChunkOverlap int     `json:"chunkOverlap"`
+	Weight       float64 `json:"weight"` // multiplies the similarity of the field's chunks
+	Prefix       string  `json:"prefix"` // prepended to every chunk, defaults to "<field name>: "
+}
+
+// defaultIndexedFieldTypes are indexed unless the field opts out
+var defaultIndexedFieldTypes = map[FieldType]bool{
+	FieldTypeText:     true,
+	FieldTypeTextarea: true,
+	FieldTypeRichText: true,
+	FieldTypeSelect:   true,
+}
+
+// optInIndexedFieldTypes are only indexed when the field opts in
+var optInIndexedFieldTypes = map[FieldType]bool{
+	FieldTypeEmail:    true,
+	FieldTypeNumber:   true,
+	FieldTypeDate:     true,
+	FieldTypeDateTime: true,
+	FieldTypeBoolean:  true,
+}
+
+// IndexOptions returns the indexing options of the field with defaults filled
+// in. Password fields are never included, whatever their options say.
+func (f FieldDefinition) IndexOptions() FieldIndexOptions {
+	opts := FieldIndexOptions{
+		Include:      defaultIndexedFieldTypes[f.Type],
+		ChunkSize:    DefaultIndexChunkSize,
+		ChunkOverlap: DefaultIndexChunkOverlap,
+		Weight:       1,
+		Prefix:       f.Name + ": ",
+	}
+
+	switch index := f.Options["index"].(type) {
+	case bool:
+		opts.Include = index
+	case map[string]interface{}:
+		if include, ok := index["include"].(bool); ok {
+			opts.Include = include
+		}
+		if size, ok := index["chunkSize"].(float64); ok {
+			opts.ChunkSize = int(size)
+			if _, hasOverlap := index["chunkOverlap"]; !hasOverlap && opts.ChunkOverlap >= opts.ChunkSize {
+				opts.ChunkOverlap = opts.ChunkSize / 5
+			}
+		}
+		if overlap, ok := index["chunkOverlap"].(float64); ok {
+			opts.ChunkOverlap = int(overlap)
+		}
+		if weight, ok := index["weight"].(float64); ok {
+			opts.Weight = weight
+		}
+		if prefix, ok := index["prefix"].(string); ok {
+			opts.Prefix = prefix
+		}
+	}
+
+	if !defaultIndexedFieldTypes[f.Type] && !optInIndexedFieldTypes[f.Type] {
+		opts.Include = false
+	}
+	return opts
+}
+
+// validateIndexOptions checks the "index" option of a field
+func validateIndexOptions(field FieldDefinition) error {
+	index, exists := field.Options["index"]
+	if !exists {
+		return nil
+	}
+
+	indexable := defaultIndexedFieldTypes[field.Type] || optInIndexedFieldTypes[field.Type]
+
+	var include bool
+	var settings map[string]interface{}
+	switch v := index.(type) {
+	case bool:
+		include = v
+	case map[string]interface{}:
+		settings = v
+		if value, exists := v["include"]; exists {
+			b, ok := value.(bool)
+			if !ok {
+				return fmt.Errorf("field %s: 'index.include' must be a boolean", field.Name)
+			}
+			include = b
+		} else {
+			include = defaultIndexedFieldTypes[field.Type]
+		}
+	default:
+		return fmt.Errorf("field %s: 'index' must be a boolean or an object", field.Name)
+	}
+
+	if include && field.Type == FieldTypePassword {
+		return fmt.Errorf("password field %s cannot be indexed", field.Name)
+	}
+	if include && !indexable {
+		return fmt.Errorf("%s field %s cannot be indexed", field.Type, field.Name)
+	}
+
+	for key := range settings {
+		switch key {
+		case "include", "chunkSize", "chunkOverlap", "weight", "prefix":
+		default:
+			return fmt.Errorf("field %s: unknown index option '%s'", field.Name, key)
+		}
+	}
+
+	chunkSize := DefaultIndexChunkSize
+	if value, exists := settings["chunkSize"]; exists {
+		v, ok := value.(float64)
+		if !ok || v <= 0 || v != float64(int(v)) || v > MaxIndexChunkSize {
+			return fmt.Errorf("field %s: 'index.chunkSize' must be a positive integer up to %d", field.Name, MaxIndexChunkSize)
+		}
+		chunkSize = int(v)
+	}
+	if value, exists := settings["chunkOverlap"]; exists {
+		v, ok := value.(float64)
+		if !ok || v < 0 || v != float64(int(v)) {
+			return fmt.Errorf("field %s: 'index.chunkOverlap' must be a non-negative integer", field.Name)
+		}
+		if int(v) >= chunkSize {
+			return fmt.Errorf("field %s: 'index.chunkOverlap' must be smaller than the chunk size", field.Name)
+		}
+	}
+	if value, exists := settings["weight"]; exists {
+		v, ok := value.(float64)
+		if !ok || v <= 0 || v > MaxIndexWeight {
+			return fmt.Errorf("field %s: 'index.weight' must be a number greater than 0 and at most %d", field.Name, MaxIndexWeight)
+		}
+	}
+	if value, exists := settings["prefix"]; exists {
+		v, ok := value.(string)
+		if !ok || utf8.RuneCountInString(v) > MaxIndexPrefixLength {
+			return fmt.Errorf("field %s: 'index.prefix' must be a string of at most %d characters", field.Name, MaxIndexPrefixLength)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Patterns of the date and datetime values content validation accepts, in a
+// syntax both Go and Postgres regular expressions read. UTC offsets go up to
+// 15:59, the largest Postgres converts.
+const (
+	datePattern     = `^[0-9]{4}-(0[1-9]|1[0-2])-(0[1-9]|[12][0-9]|3[01])$`
+	datetimePattern = `^[0-9]{4}-[0-9]{2}-[0-9]{2}T([01][0-9]|2[0-3]):[0-5][0-9]:[0-5][0-9](\.[0-9]+)?(Z|[+-](0[0-9]|1[0-5]):[0-5][0-9])$`
+)
+
+// SortFunctionsSQL creates the functions that convert stored date and datetime
+// values for sorting and filtering. Values validation would reject, such as
+// the ones left by a change of field type, convert to NULL instead of failing
+// the query or the index build. Casts from text are only stable, which rules
+// them out of an index, but the accepted values carry their offset and always
+// convert the same way. The day is checked against the length of its month
+// before the cast, as CASE is the only guaranteed order of evaluation.
+var SortFunctionsSQL = []string{
+	`CREATE OR REPLACE FUNCTION content_date(value text) RETURNS date
+	LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE
+	AS $$ SELECT CASE WHEN value ~ '` + datePattern + `' AND substr(value, 1, 4) <> '0000' THEN
+		CASE WHEN CAST(substr(value, 9, 2) AS int) <= extract(day FROM make_date(CAST(substr(value, 1, 4) AS int), CAST(substr(value, 6, 2) AS int), 1) + interval '1 month - 1 day') THEN
+			CAST(value AS date)
+		END
+	END $$`,
+	`CREATE OR REPLACE FUNCTION content_timestamptz(value text) RETURNS timestamptz
+	LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE
+	AS $$ SELECT CASE WHEN value ~ '` + datetimePattern + `' AND content_date(substr(value, 1, 10)) IS NOT NULL THEN
+		CAST(value AS timestamptz)
+	END $$`,
+}
+
+const sortIndexPrefix = "idx_content_sort_"
+
+var collationRegex = regexp.MustCompile(`^[A-Za-z0-9_.@-]+$`)
+
+// sortCollation is the collation text fields are sorted with, empty for the
+// database default
+var sortCollation string
+
+// SetSortCollation sets the collation used to sort text fields, e.g. "en-x-icu"
+func SetSortCollation(collation string) error {
+	if collation != "" && !collationRegex.MatchString(collation) {
+		return fmt.Errorf("invalid collation '%s'", collation)
+	}
+	sortCollation = collation
+	return nil
+}
+
+// sortableFieldTypes are the field types content can be sorted by
+var sortableFieldTypes = map[FieldType]bool{
+	FieldTypeText:     true,
+	FieldTypeTextarea: true,
+	FieldTypeEmail:    true,
+	FieldTypeSelect:   true,
+	FieldTypeRelation: true,
+	FieldTypeNumber:   true,
+	FieldTypeDate:     true,
+	FieldTypeDateTime: true,
+	FieldTypeBoolean:  true,
+}
+
+// SortExpression returns the SQL expression content entries are sorted by for
+// the field, cast according to its type. Values of another JSON type sort as
+// NULL. The field name is quoted into the expression, so that it is the same
+// expression as the one of the field's sort index.
+func (f FieldDefinition) SortExpression() (string, error) {
+	if !sortableFieldTypes[f.Type] {
+		return "", fmt.Errorf("%s field '%s' cannot be sorted", f.Type, f.Name)
+	}
+
+	name := quoteLiteral(f.Name)
+	typed := func(jsonType string) string {
+		return fmt.Sprintf("CASE WHEN jsonb_typeof(data -> %s) = '%s' THEN data ->> %s END", name, jsonType, name)
+	}
+
+	switch f.Type {
+	case FieldTypeNumber:
+		return fmt.Sprintf("(CAST(%s AS numeric))", typed("number")), nil
+	case FieldTypeBoolean:
+		return fmt.Sprintf("(CAST(%s AS boolean))", typed("boolean")), nil
+	case FieldTypeDate:
+		// YYYY-MM-DD sorts correctly as bytes
+		return fmt.Sprintf(`((%s) COLLATE "C")`, typed("string")), nil
+	case FieldTypeDateTime:
+		return fmt.Sprintf("(content_timestamptz(%s))", typed("string")), nil
+	default:
+		if sortCollation != "" {
+			return fmt.Sprintf(`((%s) COLLATE "%s")`, typed("string"), sortCollation), nil
+		}
+		return fmt.Sprintf("(%s)", typed("string")), nil
+	}
+}
+
+// SortType returns the SQL type of the field's sort expression
+func (f FieldDefinition) SortType() string {
+	switch f.Type {
+	case FieldTypeNumber:
+		return "numeric"
+	case FieldTypeBoolean:
+		return "boolean"
+	case FieldTypeDateTime:
+		return "timestamptz"
+	default:
+		return "text"
+	}
+}
+
+// Sortable reports whether the field asks for a sort index with the
+// "sortable" option
+func (f FieldDefinition) Sortable() bool {
+	sortable, _ := f.Options["sortable"].(bool)
+	return sortable && sortableFieldTypes[f.Type]
+}
+
+// validateSortOptions checks the "sortable" option of a field
+func validateSortOptions(field FieldDefinition) error {
+	sortable, exists := field.Options["sortable"]
+	if !exists {
+		return nil
+	}
+	b, ok := sortable.(bool)
+	if !ok {
+		return fmt.Errorf("field %s: 'sortable' must be a boolean", field.Name)
+	}
+	if b && !sortableFieldTypes[field.Type] {
+		return fmt.Errorf("%s field %s cannot be sortable", field.Type, field.Name)
+	}
+	if b && field.Type == FieldTypeRelation && field.ToMany() {
+		return fmt.Errorf("%s relation field %s cannot be sortable", field.RelationType(), field.Name)
+	}
+	return nil
+}
+
+// sortIndexName names the sort index of an expression on a schema's entries.
+// The name changes with the expression, so a changed field type or collation
+// gets a new index.
+func sortIndexName(schemaID uuid.UUID, expression string) string {
+	h := fnv.New32a()
+	h.Write([]byte(expression))
+	return fmt.Sprintf("%s%s_%08x", sortIndexPrefix, strings.ReplaceAll(schemaID.String(), "-", ""), h.Sum32())
+}
+
+// LockSortIndexes takes the advisory lock of a schema's sort indexes, so their
+// syncs run one at a time across instances. The lock belongs to a connection
+// of its own, which the returned function releases; it goes away with the
+// connection if the process dies.
+func LockSortIndexes(db *gorm.DB, schemaID uuid.UUID) (func(), error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(sortIndexPrefix + schemaID.String()))
+	key := int64(h.Sum64())
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", key)
+		conn.Close()
+	}, nil
+}
+
+// SyncSortIndexes creates a partial expression index for every sortable field
+// of the schema and drops the indexes of fields that are no longer sortable.
+// The indexes are built concurrently, so writes are not blocked.
+func SyncSortIndexes(db *gorm.DB, schemaID uuid.UUID, fields []FieldDefinition) error {
+	wanted := make(map[string]string)
+	for _, field := range fields {
+		if !field.Sortable() {
+			continue
+		}
+		expression, err := field.SortExpression()
+		if err != nil {
+			return err
+		}
+		wanted[sortIndexName(schemaID, expression)] = expression
+	}
+
+	var existing []string
+	if err := db.Raw("SELECT indexname FROM pg_indexes WHERE tablename = 'content_entries' AND indexname LIKE ?",
+		sortIndexPrefix+strings.ReplaceAll(schemaID.String(), "-", "")+"\\_%").
+		Scan(&existing).Error; err != nil {
+		return err
+	}
+
+	for _, name := range existing {
+		if _, keep := wanted[name]; keep {
+			delete(wanted, name)
+			continue
+		}
+		if err := db.Exec(fmt.Sprintf(`DROP INDEX CONCURRENTLY IF EXISTS "%s"`, name)).Error; err != nil {
+			return err
+		}
+	}
+
+	for name, expression := range wanted {
+		// The id makes the order total, like the tiebreaker of the queries
+		if err := db.Exec(fmt.Sprintf(`CREATE INDEX CONCURRENTLY IF NOT EXISTS "%s" ON content_entries (%s, id) WHERE content_type_id = %s`,
+			name, expression, quoteLiteral(schemaID.String()))).Error; err != nil {
+			// A failed concurrent build leaves an invalid index behind
+			db.Exec(fmt.Sprintf(`DROP INDEX CONCURRENTLY IF EXISTS "%s"`, name))
+			return err
+		}
+	}
+	return nil
+}
+
+// quoteLiteral quotes a string as an SQL literal
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sqlDate mirrors the check of content_date: the pattern, a year after 0
+// and a day within its month
+func sqlDate(value string) bool {
+	if !regexp.MustCompile(datePattern).MatchString(value) || value[:4] == "0000" {
+		return false
+	}
+	year, _ := strconv.Atoi(value[:4])
+	month, _ := strconv.Atoi(value[5:7])
+	day, _ := strconv.Atoi(value[8:10])
+	return day <= time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// sqlDatetime mirrors the check of content_timestamptz
+func sqlDatetime(value string) bool {
+	return regexp.MustCompile(datetimePattern).MatchString(value) && sqlDate(value[:10])
+}
+
+// TestSortFunctionsGuardValues checks the values the conversion functions cast
+// and the ones they turn into NULL, such as the text a field held before its
+// type was changed to date or datetime. A cast value must be one validation
+// accepts, so the cast cannot fail.
+func TestSortFunctionsGuardValues(t *testing.T) {
+	datetimes := []struct {
+		value string
+		cast  bool
+	}{
+		{"2024-01-02T12:00:00Z", true},
+		{"2024-01-02T12:00:00.123456+08:00", true},
+		{"2024-02-29T23:59:59-05:30", true},
+		{"1999-12-31T00:00:00+15:59", true},
+		{"", false},
+		{"next week", false},
+		{"2024-01-02", false},
+		{"2024-01-02 12:00:00", false},
+		{"2024-01-02T12:00:00", false},
+		{"2024-01-02t12:00:00z", false},
+		{"2023-02-29T12:00:00Z", false},
+		{"2024-04-31T12:00:00Z", false},
+		{"2024-13-01T12:00:00Z", false},
+		{"2024-01-02T24:00:00Z", false},
+		{"2024-01-02T12:60:00Z", false},
+		{"0000-01-01T00:00:00Z", false},
+		{"2024-01-02T12:00:00+16:00", false},
+		{"2024-01-02T12:00:00Z; DROP TABLE x", false},
+	}
+	for _, tt := range datetimes {
+		if got := sqlDatetime(tt.value); got != tt.cast {
+			t.Errorf("datetime %q: got cast %v, want %v", tt.value, got, tt.cast)
+		}
+		if tt.cast {
+			if _, err := time.Parse(time.RFC3339, tt.value); err != nil {
+				t.Errorf("datetime %q is cast but fails validation: %v", tt.value, err)
+			}
+		}
+	}
+
+	dates := []struct {
+		value string
+		cast  bool
+	}{
+		{"2024-01-02", true},
+		{"2024-02-29", true},
+		{"2023-02-29", false},
+		{"2024-06-31", false},
+		{"2024-00-10", false},
+		{"0000-01-01", false},
+		{"2024-1-2", false},
+		{"02/01/2024", false},
+		{"2024-01-02T12:00:00Z", false},
+	}
+	for _, tt := range dates {
+		if got := sqlDate(tt.value); got != tt.cast {
+			t.Errorf("date %q: got cast %v, want %v", tt.value, got, tt.cast)
+		}
+		if tt.cast {
+			if _, err := time.Parse("2006-01-02", tt.value); err != nil {
+				t.Errorf("date %q is cast but fails validation: %v", tt.value, err)
+			}
+		}
+	}
+}
+
+// TestSortExpressionAfterTypeChange checks that changing a text field to a
+// datetime converts its values through the guarded function, and that the
+// field gets a new sort index
+func TestSortExpressionAfterTypeChange(t *testing.T) {
+	schemaID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	options := map[string]interface{}{"sortable": true}
+	before := FieldDefinition{Name: "when", Type: FieldTypeText, Options: options}
+	after := FieldDefinition{Name: "when", Type: FieldTypeDateTime, Options: options}
+
+	textExpression, err := before.SortExpression()
+	if err != nil {
+		t.Fatalf("SortExpression: %v", err)
+	}
+	datetimeExpression, err := after.SortExpression()
+	if err != nil {
+		t.Fatalf("SortExpression: %v", err)
+	}
+
+	if !strings.HasPrefix(datetimeExpression, "(content_timestamptz(") || strings.Contains(datetimeExpression, "AS timestamptz") {
+		t.Errorf("datetime values must only be converted by content_timestamptz, got %s", datetimeExpression)
+	}
+	if sortIndexName(schemaID, textExpression) == sortIndexName(schemaID, datetimeExpression) {
+		t.Error("the sort index must change with the field type")
+	}
+	for _, statement := range SortFunctionsSQL {
+		if strings.Contains(statement, "content_timestamptz") && !strings.Contains(statement, datetimePattern) {
+			t.Error("content_timestamptz must check the datetime pattern")
+		}
+	}
+}
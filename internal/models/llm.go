@@ -6,4 +6,5 @@ const (
 	LLMProviderOpenAI LLMProvider = "openai"
 	LLMProviderQwen   LLMProvider = "qwen"
 	LLMProviderDoubao LLMProvider = "doubao"
+	LLMProviderOllama LLMProvider = "ollama"
 )
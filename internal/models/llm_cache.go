@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// LLMCacheEntry is a cached LLM response, keyed by the hash of its request
+type LLMCacheEntry struct {
+	Key       string         `json:"key" gorm:"type:varchar(64);primaryKey"`
+	Response  datatypes.JSON `json:"response" gorm:"type:jsonb;not null"`
+	ExpiresAt time.Time      `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime"`
+}
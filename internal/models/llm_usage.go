@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LLMUsage records the tokens one LLM call of an API user consumed
+type LLMUsage struct {
+	ID               uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	APIUserID        uuid.UUID `json:"api_user_id" gorm:"type:uuid;not null;index:idx_llm_usage_user_time,priority:1"`
+	Endpoint         string    `json:"endpoint" gorm:"type:varchar(255);not null"` // route of the request, e.g. /api/llm/chat
+	Provider         string    `json:"provider" gorm:"type:varchar(100)"`          // backend that served the call
+	Model            string    `json:"model" gorm:"type:varchar(255)"`             // model requested, empty for the default
+	PromptTokens     int       `json:"prompt_tokens" gorm:"not null;default:0"`
+	CompletionTokens int       `json:"completion_tokens" gorm:"not null;default:0"`
+	TotalTokens      int       `json:"total_tokens" gorm:"not null;default:0"`
+	Estimated        bool      `json:"estimated" gorm:"not null;default:false"` // the provider did not report usage
+	CreatedAt        time.Time `json:"created_at" gorm:"autoCreateTime;index:idx_llm_usage_user_time,priority:2"`
+}
+
+// StartOfDay returns the start of the UTC day of t, when daily quotas reset
+func StartOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// StartOfMonth returns the start of the UTC month of t, when monthly quotas reset
+func StartOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// SumLLMTokens returns the tokens an API user consumed since the given time
+func SumLLMTokens(db *gorm.DB, apiUserID uuid.UUID, since time.Time) (int64, error) {
+	var total int64
+	err := db.Model(&LLMUsage{}).
+		Select("COALESCE(SUM(total_tokens), 0)").
+		Where("api_user_id = ? AND created_at >= ?", apiUserID, since).
+		Scan(&total).Error
+	return total, err
+}
@@ -16,7 +16,7 @@ const (
 )
 
 type Media struct {
-	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4();index:idx_media_created,priority:2"`
 	Name      string    `json:"name" gorm:"type:varchar(255);not null"`
 	Type      MediaType `json:"type" gorm:"type:varchar(255);not null"`
 	MimeType  string    `json:"mime_type" gorm:"type:varchar(255);not null"`
@@ -26,7 +26,7 @@ type Media struct {
 	Width     *int      `json:"width,omitempty"`
 	Height    *int      `json:"height,omitempty"`
 	Duration  *int      `json:"duration,omitempty"`
-	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime;index:idx_media_created,priority:1"` // with the id, the order of media listings
 	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 	CreatedBy uuid.UUID `json:"created_by" gorm:"type:uuid;not null"`
 }
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ContentVariablePrefix marks template variables filled from a content entry,
+// e.g. {{content.title}}
+const ContentVariablePrefix = "content."
+
+var (
+	templateNameRegex     = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	templateVariableRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// PromptTemplate is a versioned prompt. Saving a template under an existing
+// name adds a new version, so runs can be pinned to the version they were
+// written for.
+type PromptTemplate struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	Name        string         `json:"name" gorm:"type:varchar(100);not null;uniqueIndex:idx_prompt_template_version,priority:1"`
+	Version     int            `json:"version" gorm:"not null;uniqueIndex:idx_prompt_template_version,priority:2"`
+	Description string         `json:"description" gorm:"type:text"`
+	System      string         `json:"system" gorm:"type:text"`        // system prompt, may contain variables
+	Body        string         `json:"body" gorm:"type:text;not null"` // user prompt with {{variables}}
+	Variables   pq.StringArray `json:"variables" gorm:"type:text[]"`   // the variables used, set on validation
+	Model       string         `json:"model,omitempty" gorm:"type:varchar(255)"`
+	MaxTokens   int            `json:"max_tokens,omitempty"`
+	Temperature *float64       `json:"temperature,omitempty"` // nil leaves it to the provider's default
+	CreatedByID *uuid.UUID     `json:"created_by_id" gorm:"type:uuid"`
+	CreatedAt   time.Time      `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// Validate checks the name, settings and placeholders of the template and
+// records the variables it uses
+func (t *PromptTemplate) Validate() error {
+	if !templateNameRegex.MatchString(t.Name) {
+		return errors.New("name must be lowercase letters, digits and hyphens, e.g. product-summary")
+	}
+	if strings.TrimSpace(t.Body) == "" {
+		return errors.New("body is required")
+	}
+	if t.MaxTokens < 0 {
+		return errors.New("max_tokens cannot be negative")
+	}
+	if t.Temperature != nil && (*t.Temperature < 0 || *t.Temperature > 2) {
+		return errors.New("temperature must be between 0 and 2")
+	}
+
+	var variables []string
+	seen := make(map[string]bool)
+	for _, part := range []struct{ name, text string }{{"system", t.System}, {"body", t.Body}} {
+		names, err := templateVariables(part.text)
+		if err != nil {
+			return fmt.Errorf("%s: %v", part.name, err)
+		}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				variables = append(variables, name)
+			}
+		}
+	}
+
+	t.Variables = variables
+	return nil
+}
+
+// Render fills the variables of the system text and body. It returns the
+// names of the variables without a value, in which case nothing is rendered.
+func (t *PromptTemplate) Render(values map[string]string) (system string, body string, missing []string) {
+	for _, name := range t.Variables {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", "", missing
+	}
+
+	return renderTemplate(t.System, values), renderTemplate(t.Body, values), nil
+}
+
+// templateVariables returns the variables of a text in order of appearance.
+// A variable is {{name}} or {{content.field}}, spaces inside the braces are
+// allowed.
+func templateVariables(text string) ([]string, error) {
+	var names []string
+	rest := text
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			if strings.Contains(rest, "}}") {
+				return nil, errors.New("'}}' without matching '{{'")
+			}
+			return names, nil
+		}
+		if strings.Contains(rest[:start], "}}") {
+			return nil, errors.New("'}}' without matching '{{'")
+		}
+
+		end := strings.Index(rest[start+2:], "}}")
+		if end < 0 {
+			return nil, errors.New("'{{' is not closed")
+		}
+		name := strings.TrimSpace(rest[start+2 : start+2+end])
+		if err := validateTemplateVariable(name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		rest = rest[start+2+end+2:]
+	}
+}
+
+func validateTemplateVariable(name string) error {
+	field, isContent := strings.CutPrefix(name, ContentVariablePrefix)
+	if !templateVariableRegex.MatchString(field) {
+		if isContent {
+			return fmt.Errorf("invalid content field '%s'", field)
+		}
+		return fmt.Errorf("invalid variable '%s', use letters, digits and underscores", name)
+	}
+	return nil
+}
+
+// renderTemplate replaces the placeholders of a validated text
+func renderTemplate(text string, values map[string]string) string {
+	var b strings.Builder
+	rest := text
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			b.WriteString(rest)
+			return b.String()
+		}
+		end := strings.Index(rest[start+2:], "}}")
+		if end < 0 {
+			b.WriteString(rest)
+			return b.String()
+		}
+
+		b.WriteString(rest[:start])
+		b.WriteString(values[strings.TrimSpace(rest[start+2:start+2+end])])
+		rest = rest[start+2+end+2:]
+	}
+}
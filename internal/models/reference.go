@@ -0,0 +1,375 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OnDeletePolicy is what happens to an entry when the content or media one of
+// its fields refers to is deleted
+type OnDeletePolicy string
+
+const (
+	OnDeleteRestrict OnDeletePolicy = "restrict" // the delete is refused
+	OnDeleteSetNull  OnDeletePolicy = "set-null" // the value is cleared, or removed from a list
+	OnDeleteCascade  OnDeletePolicy = "cascade"  // the entry is deleted as well
+)
+
+// referenceFieldTypes are the field types that refer to other content or media
+var referenceFieldTypes = map[FieldType]bool{
+	FieldTypeRelation:  true,
+	FieldTypeMedia:     true,
+	FieldTypeMediaList: true,
+}
+
+// holdsList reports whether the field value is a list of references, which
+// set-null shortens instead of clearing
+func (f FieldDefinition) holdsList() bool {
+	return f.Type == FieldTypeMediaList || (f.Type == FieldTypeRelation && f.ToMany())
+}
+
+// OnDelete returns the "onDelete" option of a reference field. Without one, a
+// required single reference restricts and everything else is set to null.
+func (f FieldDefinition) OnDelete() OnDeletePolicy {
+	if policy, ok := f.Options["onDelete"].(string); ok && policy != "" {
+		return OnDeletePolicy(policy)
+	}
+	if f.Required && !f.holdsList() {
+		return OnDeleteRestrict
+	}
+	return OnDeleteSetNull
+}
+
+// validateOnDeleteOptions checks the "onDelete" option of a field
+func validateOnDeleteOptions(field FieldDefinition) error {
+	option, exists := field.Options["onDelete"]
+	if !exists {
+		return nil
+	}
+	if !referenceFieldTypes[field.Type] {
+		return fmt.Errorf("%s field %s cannot have 'onDelete', only relation and media fields", field.Type, field.Name)
+	}
+	policy, ok := option.(string)
+	if !ok {
+		return fmt.Errorf("field %s: 'onDelete' must be a string", field.Name)
+	}
+	switch OnDeletePolicy(policy) {
+	case OnDeleteRestrict, OnDeleteCascade:
+	case OnDeleteSetNull:
+		if field.Required && !field.holdsList() {
+			return fmt.Errorf("required field %s cannot use onDelete 'set-null'", field.Name)
+		}
+	default:
+		return fmt.Errorf("field %s: invalid onDelete '%s', use restrict, set-null or cascade", field.Name, policy)
+	}
+	return nil
+}
+
+// Reference is an entry that refers to content or media through a field
+type Reference struct {
+	SchemaID   uuid.UUID      `json:"schema_id"`
+	SchemaSlug string         `json:"schema_slug"`
+	EntryID    uuid.UUID      `json:"entry_id"`
+	EntrySlug  string         `json:"entry_slug"`
+	Field      string         `json:"field"`
+	OnDelete   OnDeletePolicy `json:"on_delete"`
+	Value      string         `json:"value"` // the slug or media ID the field holds
+}
+
+// referenceSchemas loads schemas and their fields once per lookup
+type referenceSchemas struct {
+	db      *gorm.DB
+	schemas map[uuid.UUID]*Schema
+	fields  map[uuid.UUID]map[string]FieldDefinition
+}
+
+func newReferenceSchemas(db *gorm.DB) *referenceSchemas {
+	return &referenceSchemas{
+		db:      db,
+		schemas: make(map[uuid.UUID]*Schema),
+		fields:  make(map[uuid.UUID]map[string]FieldDefinition),
+	}
+}
+
+func (r *referenceSchemas) get(id uuid.UUID) (*Schema, map[string]FieldDefinition, error) {
+	if schema, ok := r.schemas[id]; ok {
+		return schema, r.fields[id], nil
+	}
+	var schema Schema
+	if err := r.db.Where("id = ?", id).First(&schema).Error; err != nil {
+		return nil, nil, err
+	}
+	var fields []FieldDefinition
+	if err := json.Unmarshal(schema.Fields, &fields); err != nil {
+		return nil, nil, err
+	}
+	byName := make(map[string]FieldDefinition, len(fields))
+	for _, field := range fields {
+		byName[field.Name] = field
+	}
+	r.schemas[id] = &schema
+	r.fields[id] = byName
+	return &schema, byName, nil
+}
+
+// ContentUsages returns the references to the given entries, through the
+// relation links
+func ContentUsages(db *gorm.DB, entryIDs []uuid.UUID) ([]Reference, error) {
+	return contentUsages(db, newReferenceSchemas(db), entryIDs)
+}
+
+func contentUsages(db *gorm.DB, schemas *referenceSchemas, entryIDs []uuid.UUID) ([]Reference, error) {
+	if len(entryIDs) == 0 {
+		return nil, nil
+	}
+	var links []ContentRelation
+	if err := db.Where("target_id IN ?", entryIDs).Order("source_schema_id, source_id, field_name, position").Find(&links).Error; err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(links)*2)
+	for _, link := range links {
+		ids = append(ids, link.SourceID, link.TargetID)
+	}
+	var entries []ContentEntry
+	if err := db.Select("id", "slug", "content_type_id").Where("id IN ?", ids).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	slugs := make(map[uuid.UUID]string, len(entries))
+	for _, entry := range entries {
+		slugs[entry.ID] = entry.Slug
+	}
+
+	references := make([]Reference, 0, len(links))
+	for _, link := range links {
+		schema, fields, err := schemas.get(link.SourceSchemaID)
+		if err != nil {
+			return nil, err
+		}
+		field, exists := fields[link.FieldName]
+		if !exists {
+			continue
+		}
+		references = append(references, Reference{
+			SchemaID:   schema.ID,
+			SchemaSlug: schema.Slug,
+			EntryID:    link.SourceID,
+			EntrySlug:  slugs[link.SourceID],
+			Field:      link.FieldName,
+			OnDelete:   field.OnDelete(),
+			Value:      slugs[link.TargetID],
+		})
+	}
+	return references, nil
+}
+
+// MediaUsages returns the references to a media through the media and media
+// list fields of every schema
+func MediaUsages(db *gorm.DB, mediaID uuid.UUID) ([]Reference, error) {
+	var schemas []Schema
+	if err := db.Order("slug").Find(&schemas).Error; err != nil {
+		return nil, err
+	}
+
+	value := mediaID.String()
+	var references []Reference
+	for _, schema := range schemas {
+		var fields []FieldDefinition
+		if err := json.Unmarshal(schema.Fields, &fields); err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			if field.Type != FieldTypeMedia && field.Type != FieldTypeMediaList {
+				continue
+			}
+
+			// Media fields hold an ID or a list of IDs, media lists a list
+			inList, _ := json.Marshal(map[string]interface{}{field.Name: []string{value}})
+			query := db.Select("id", "slug").Where("content_type_id = ?", schema.ID)
+			if field.Type == FieldTypeMedia {
+				single, _ := json.Marshal(map[string]interface{}{field.Name: value})
+				query = query.Where("(data @> CAST(? AS jsonb) OR data @> CAST(? AS jsonb))", string(single), string(inList))
+			} else {
+				query = query.Where("data @> CAST(? AS jsonb)", string(inList))
+			}
+
+			var entries []ContentEntry
+			if err := query.Order("slug").Find(&entries).Error; err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				references = append(references, Reference{
+					SchemaID:   schema.ID,
+					SchemaSlug: schema.Slug,
+					EntryID:    entry.ID,
+					EntrySlug:  entry.Slug,
+					Field:      field.Name,
+					OnDelete:   field.OnDelete(),
+					Value:      value,
+				})
+			}
+		}
+	}
+	return references, nil
+}
+
+// DeletePlan is what deleting content or media does to the entries that refer
+// to it, following cascades
+type DeletePlan struct {
+	Entries  []uuid.UUID // entries asked to be deleted
+	Cascade  []uuid.UUID // entries deleted by cascade
+	Restrict []Reference // references that block the delete
+	SetNull  []Reference // values to clear in the entries that remain
+
+	cascadeSchemas map[string]bool // slugs of the schemas of the cascaded entries
+}
+
+// Scopes returns the API scopes the side effects of the plan need: delete on
+// the schemas of the entries deleted by cascade, and update on the schemas of
+// the entries whose references are cleared
+func (p *DeletePlan) Scopes() []string {
+	seen := make(map[string]bool)
+	for slug := range p.cascadeSchemas {
+		seen[slug+":delete"] = true
+	}
+	for _, reference := range p.SetNull {
+		seen[reference.SchemaSlug+":update"] = true
+	}
+	scopes := make([]string, 0, len(seen))
+	for scope := range seen {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// PlanContentDelete works out the deletion of entries
+func PlanContentDelete(db *gorm.DB, entryIDs []uuid.UUID) (*DeletePlan, error) {
+	return planDelete(db, newReferenceSchemas(db), entryIDs, nil)
+}
+
+// PlanMediaDelete works out the deletion of a media
+func PlanMediaDelete(db *gorm.DB, mediaID uuid.UUID) (*DeletePlan, error) {
+	references, err := MediaUsages(db, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	return planDelete(db, newReferenceSchemas(db), nil, references)
+}
+
+// planDelete walks the references to the deleted entries, and the entries
+// their cascades delete, until no new entry is deleted
+func planDelete(db *gorm.DB, schemas *referenceSchemas, entryIDs []uuid.UUID, references []Reference) (*DeletePlan, error) {
+	plan := &DeletePlan{cascadeSchemas: make(map[string]bool)}
+	deleted := make(map[uuid.UUID]bool)
+	var restrict, setNull []Reference
+
+	for _, id := range entryIDs {
+		if !deleted[id] {
+			deleted[id] = true
+			plan.Entries = append(plan.Entries, id)
+		}
+	}
+
+	batch := plan.Entries
+	for {
+		usages, err := contentUsages(db, schemas, batch)
+		if err != nil {
+			return nil, err
+		}
+		references = append(references, usages...)
+		if len(references) == 0 {
+			break
+		}
+
+		batch = nil
+		for _, reference := range references {
+			switch reference.OnDelete {
+			case OnDeleteCascade:
+				if !deleted[reference.EntryID] {
+					deleted[reference.EntryID] = true
+					batch = append(batch, reference.EntryID)
+					plan.Cascade = append(plan.Cascade, reference.EntryID)
+					plan.cascadeSchemas[reference.SchemaSlug] = true
+				}
+			case OnDeleteRestrict:
+				restrict = append(restrict, reference)
+			default:
+				setNull = append(setNull, reference)
+			}
+		}
+		references = nil
+	}
+
+	// References from entries that are deleted anyway do not matter
+	for _, reference := range restrict {
+		if !deleted[reference.EntryID] {
+			plan.Restrict = append(plan.Restrict, reference)
+		}
+	}
+	for _, reference := range setNull {
+		if !deleted[reference.EntryID] {
+			plan.SetNull = append(plan.SetNull, reference)
+		}
+	}
+	return plan, nil
+}
+
+// Apply clears the set-null values, as a new version of each entry made by the
+// user, and deletes the entries of the plan with their links. It must not be
+// applied while the plan has restrictions.
+func (p *DeletePlan) Apply(db *gorm.DB, userType ContentEntryUserByType, userID uuid.UUID) error {
+	if len(p.Restrict) > 0 {
+		return fmt.Errorf("the delete is restricted by %d references", len(p.Restrict))
+	}
+
+	bySource := make(map[uuid.UUID][]Reference)
+	for _, reference := range p.SetNull {
+		bySource[reference.EntryID] = append(bySource[reference.EntryID], reference)
+	}
+	for entryID, references := range bySource {
+		var entry ContentEntry
+		if err := db.Where("id = ?", entryID).First(&entry).Error; err != nil {
+			return err
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(entry.Data, &data); err != nil {
+			return err
+		}
+		for _, reference := range references {
+			switch v := data[reference.Field].(type) {
+			case string:
+				if v == reference.Value {
+					data[reference.Field] = nil
+				}
+			case []interface{}:
+				kept := make([]interface{}, 0, len(v))
+				for _, item := range v {
+					if item != reference.Value {
+						kept = append(kept, item)
+					}
+				}
+				data[reference.Field] = kept
+			}
+		}
+		if err := saveRewrittenData(db, entry, data, "References to deleted content cleared", userType, userID); err != nil {
+			return err
+		}
+	}
+
+	entries := append(append([]uuid.UUID{}, p.Entries...), p.Cascade...)
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := db.Where("source_id IN ? OR target_id IN ?", entries, entries).Delete(&ContentRelation{}).Error; err != nil {
+		return err
+	}
+	return db.Where("id IN ?", entries).Delete(&ContentEntry{}).Error
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeletePlanScopes(t *testing.T) {
+	tests := []struct {
+		name string
+		plan DeletePlan
+		want []string
+	}{
+		{"nothing changed", DeletePlan{}, []string{}},
+		{"cascades and cleared references", DeletePlan{
+			cascadeSchemas: map[string]bool{"comment": true, "reaction": true},
+			SetNull: []Reference{
+				{SchemaSlug: "post", Field: "author"},
+				{SchemaSlug: "post", Field: "editor"},
+				{SchemaSlug: "page", Field: "hero"},
+			},
+		}, []string{"comment:delete", "page:update", "post:update", "reaction:delete"}},
+		{"a schema both cascaded and cleared", DeletePlan{
+			cascadeSchemas: map[string]bool{"post": true},
+			SetNull:        []Reference{{SchemaSlug: "post", Field: "related"}},
+		}, []string{"post:delete", "post:update"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.plan.Scopes(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got scopes %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// RelationType is the cardinality of a relation field, seen from the entry
+// that holds the field
+type RelationType string
+
+const (
+	RelationOneToOne   RelationType = "one-to-one"   // one slug, each target linked once
+	RelationManyToOne  RelationType = "many-to-one"  // one slug
+	RelationOneToMany  RelationType = "one-to-many"  // list of slugs, each target linked once
+	RelationManyToMany RelationType = "many-to-many" // list of slugs
+)
+
+// RelationIndexesSQL makes sure a target of a one-to-one or one-to-many field
+// is linked by a single entry. GORM tags cannot express the partial index.
+const RelationIndexesSQL = `CREATE UNIQUE INDEX IF NOT EXISTS idx_content_relation_exclusive
+	ON content_relations (source_schema_id, field_name, target_id)
+	WHERE relation_type IN ('one_to_one', 'one_to_many')`
+
+// ContentRelation links an entry to an entry it relates to through a relation
+// field. The links mirror the slugs stored in the entry data.
+type ContentRelation struct {
+	ID             uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	SourceID       uuid.UUID `json:"source_id" gorm:"type:uuid;not null;uniqueIndex:idx_content_relation_link,priority:1"`
+	SourceSchemaID uuid.UUID `json:"source_schema_id" gorm:"type:uuid;not null;index"`
+	FieldName      string    `json:"field_name" gorm:"not null;uniqueIndex:idx_content_relation_link,priority:2"`
+	TargetID       uuid.UUID `json:"target_id" gorm:"type:uuid;not null;uniqueIndex:idx_content_relation_link,priority:3;index"`
+	TargetSchemaID uuid.UUID `json:"target_schema_id" gorm:"type:uuid;not null;index"`
+	RelationType   string    `json:"relation_type" gorm:"type:relation_type_enum;not null"` // enum value, e.g. one_to_many
+	Position       int       `json:"position" gorm:"not null;default:0"`                    // order of the target in a to-many field
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// RelationConflictError is a link that the cardinality of a field forbids
+type RelationConflictError struct {
+	Field string
+	Slug  string
+}
+
+func (e *RelationConflictError) Error() string {
+	if e.Field == "" {
+		return "a linked entry is already linked by another entry"
+	}
+	return fmt.Sprintf("field '%s' cannot link '%s', it is already linked by another entry", e.Field, e.Slug)
+}
+
+// RelationType returns the relation type of a relation field
+func (f FieldDefinition) RelationType() RelationType {
+	relationType, _ := f.Options["relationType"].(string)
+	return RelationType(relationType)
+}
+
+// ToMany reports whether a relation field holds a list of slugs
+func (f FieldDefinition) ToMany() bool {
+	relationType := f.RelationType()
+	return relationType == RelationOneToMany || relationType == RelationManyToMany
+}
+
+// exclusive reports whether a target can only be linked by one entry
+func (t RelationType) exclusive() bool {
+	return t == RelationOneToOne || t == RelationOneToMany
+}
+
+// enumValue returns the relation_type_enum value of the relation type
+func (t RelationType) enumValue() string {
+	return strings.ReplaceAll(string(t), "-", "_")
+}
+
+// RelationSlugs returns the slugs a relation field value links to. To-one
+// fields hold a slug and to-many fields a list of distinct slugs.
+func (f FieldDefinition) RelationSlugs(value interface{}) ([]string, error) {
+	if !f.ToMany() {
+		slug, ok := value.(string)
+		if !ok || slug == "" {
+			return nil, fmt.Errorf("field '%s' must be a string (slug of the related content)", f.Name)
+		}
+		return []string{slug}, nil
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field '%s' must be an array of slugs of the related content", f.Name)
+	}
+	seen := make(map[string]bool, len(list))
+	slugs := make([]string, 0, len(list))
+	for _, item := range list {
+		slug, ok := item.(string)
+		if !ok || slug == "" {
+			return nil, fmt.Errorf("field '%s' must contain only slugs of the related content", f.Name)
+		}
+		if seen[slug] {
+			return nil, fmt.Errorf("field '%s' links '%s' more than once", f.Name, slug)
+		}
+		seen[slug] = true
+		slugs = append(slugs, slug)
+	}
+	return slugs, nil
+}
+
+// linkedSlugs reads the slugs of a stored value whatever its shape, as data
+// written before a change of relation type may hold either
+func linkedSlugs(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		slugs := make([]string, 0, len(v))
+		for _, item := range v {
+			if slug, ok := item.(string); ok {
+				slugs = append(slugs, slug)
+			}
+		}
+		return slugs
+	}
+	return nil
+}
+
+// SyncRelations replaces the links of an entry with the ones of its relation
+// fields. Slugs that do not resolve are not linked. A target of an exclusive
+// field that is linked by another entry is a *RelationConflictError.
+func SyncRelations(db *gorm.DB, entry ContentEntry, fields []FieldDefinition) error {
+	var data map[string]interface{}
+	if len(entry.Data) > 0 {
+		if err := json.Unmarshal(entry.Data, &data); err != nil {
+			return err
+		}
+	}
+
+	var links []ContentRelation
+	slugsByLink := make(map[linkKey]string)
+	for _, field := range fields {
+		if field.Type != FieldTypeRelation {
+			continue
+		}
+		slugs := linkedSlugs(data[field.Name])
+		if len(slugs) == 0 {
+			continue
+		}
+
+		targetSlug, _ := field.Options["targetSchema"].(string)
+		var target Schema
+		if err := db.Where("slug = ?", targetSlug).First(&target).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				continue
+			}
+			return err
+		}
+
+		var related []ContentEntry
+		if err := db.Select("id", "slug").Where("content_type_id = ? AND slug IN ?", target.ID, slugs).Find(&related).Error; err != nil {
+			return err
+		}
+		ids := make(map[string]uuid.UUID, len(related))
+		for _, r := range related {
+			ids[r.Slug] = r.ID
+		}
+
+		relationType := field.RelationType()
+		seen := make(map[uuid.UUID]bool)
+		for position, slug := range slugs {
+			id, ok := ids[slug]
+			if !ok || seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			if relationType.exclusive() {
+				var taken int64
+				if err := db.Model(&ContentRelation{}).
+					Where("source_schema_id = ? AND field_name = ? AND target_id = ? AND source_id <> ?", entry.ContentTypeID, field.Name, id, entry.ID).
+					Count(&taken).Error; err != nil {
+					return err
+				}
+				if taken > 0 {
+					return &RelationConflictError{Field: field.Name, Slug: slug}
+				}
+			}
+
+			if relationType.exclusive() {
+				slugsByLink[linkKey{field.Name, id}] = slug
+			}
+			links = append(links, ContentRelation{
+				SourceID:       entry.ID,
+				SourceSchemaID: entry.ContentTypeID,
+				FieldName:      field.Name,
+				TargetID:       id,
+				TargetSchemaID: target.ID,
+				RelationType:   relationType.enumValue(),
+				Position:       position,
+			})
+		}
+	}
+
+	if err := db.Where("source_id = ?", entry.ID).Delete(&ContentRelation{}).Error; err != nil {
+		return err
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	if err := db.Create(&links).Error; err != nil {
+		return exclusiveLinkConflict(err, slugsByLink)
+	}
+	return nil
+}
+
+// linkKey identifies the link of a field to a target
+type linkKey struct {
+	field    string
+	targetID uuid.UUID
+}
+
+// exclusiveLinkConflict turns the unique violation of a link that another
+// entry made between the check and the insert into a *RelationConflictError.
+// The violation names the field and target in its detail.
+func exclusiveLinkConflict(err error, slugsByLink map[linkKey]string) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" || pgErr.ConstraintName != "idx_content_relation_exclusive" {
+		return err
+	}
+	for link, slug := range slugsByLink {
+		if strings.Contains(pgErr.Detail, link.field) && strings.Contains(pgErr.Detail, link.targetID.String()) {
+			return &RelationConflictError{Field: link.field, Slug: slug}
+		}
+	}
+	for link, slug := range slugsByLink {
+		if strings.Contains(pgErr.Detail, link.targetID.String()) {
+			return &RelationConflictError{Field: link.field, Slug: slug}
+		}
+	}
+	return &RelationConflictError{}
+}
+
+// RenameRelationTarget rewrites the slug of a renamed entry in the data of the
+// entries that link to it, as a new version of each, and returns the ids of
+// the rewritten entries
+func RenameRelationTarget(db *gorm.DB, targetID uuid.UUID, oldSlug, newSlug string, userType ContentEntryUserByType, userID uuid.UUID) ([]uuid.UUID, error) {
+	var links []ContentRelation
+	if err := db.Where("target_id = ?", targetID).Find(&links).Error; err != nil {
+		return nil, err
+	}
+
+	fieldsBySource := make(map[uuid.UUID][]string)
+	for _, link := range links {
+		fieldsBySource[link.SourceID] = append(fieldsBySource[link.SourceID], link.FieldName)
+	}
+
+	var rewritten []uuid.UUID
+	for sourceID, fieldNames := range fieldsBySource {
+		var source ContentEntry
+		if err := db.Where("id = ?", sourceID).First(&source).Error; err != nil {
+			return nil, err
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(source.Data, &data); err != nil {
+			return nil, err
+		}
+		for _, name := range fieldNames {
+			switch v := data[name].(type) {
+			case string:
+				if v == oldSlug {
+					data[name] = newSlug
+				}
+			case []interface{}:
+				for i, item := range v {
+					if item == oldSlug {
+						v[i] = newSlug
+					}
+				}
+			}
+		}
+		comment := fmt.Sprintf("Relation to '%s' renamed to '%s'", oldSlug, newSlug)
+		if err := saveRewrittenData(db, source, data, comment, userType, userID); err != nil {
+			return nil, err
+		}
+		rewritten = append(rewritten, sourceID)
+	}
+	return rewritten, nil
+}
+
+// saveRewrittenData stores the data of an entry that another change rewrote
+// as a new version of the entry, like an update of the entry would
+func saveRewrittenData(db *gorm.DB, entry ContentEntry, data map[string]interface{}, comment string, userType ContentEntryUserByType, userID uuid.UUID) error {
+	updated, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	entry.Data = updated
+	entry.CurrentVersion += 1
+	entry.UpdatedByType = userType
+	entry.UpdatedBy = &userID
+	if err := db.Save(&entry).Error; err != nil {
+		return err
+	}
+
+	return db.Create(&ContentVersion{
+		ID:             uuid.New(),
+		ContentEntryID: entry.ID,
+		Version:        entry.CurrentVersion,
+		Data:           entry.Data,
+		CreatedByID:    &userID,
+		Comment:        comment,
+		Status:         entry.Status,
+	}).Error
+}
+
+// BackfillRelations links the entries stored before the link table existed.
+// It only runs while the table is empty. Entries whose data breaks the
+// cardinality of a field are skipped.
+func BackfillRelations(db *gorm.DB) error {
+	var links int64
+	if err := db.Model(&ContentRelation{}).Count(&links).Error; err != nil {
+		return err
+	}
+	if links > 0 {
+		return nil
+	}
+
+	var schemas []Schema
+	if err := db.Find(&schemas).Error; err != nil {
+		return err
+	}
+	for _, schema := range schemas {
+		var fields []FieldDefinition
+		if err := json.Unmarshal(schema.Fields, &fields); err != nil {
+			return err
+		}
+		hasRelations := false
+		for _, field := range fields {
+			if field.Type == FieldTypeRelation {
+				hasRelations = true
+				break
+			}
+		}
+		if !hasRelations {
+			continue
+		}
+
+		var entries []ContentEntry
+		err := db.Where("content_type_id = ?", schema.ID).FindInBatches(&entries, 100, func(tx *gorm.DB, batch int) error {
+			for _, entry := range entries {
+				if err := SyncRelations(db, entry, fields); err != nil {
+					if _, conflict := err.(*RelationConflictError); conflict {
+						continue
+					}
+					return err
+				}
+			}
+			return nil
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestExclusiveLinkConflict(t *testing.T) {
+	author := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	editor := uuid.MustParse("00000000-0000-0000-0000-000000000002")
+	slugs := map[linkKey]string{
+		{"author", author}: "jane",
+		{"editor", editor}: "john",
+	}
+	violation := func(constraint, detail string) error {
+		return &pgconn.PgError{Code: "23505", ConstraintName: constraint, Detail: detail}
+	}
+
+	tests := []struct {
+		name      string
+		err       error
+		wantField string
+		wantSlug  string
+	}{
+		{"names the link", violation("idx_content_relation_exclusive",
+			"Key (source_schema_id, field_name, target_id)=(00000000-0000-0000-0000-000000000009, editor, "+editor.String()+") already exists."),
+			"editor", "john"},
+		{"unknown link", violation("idx_content_relation_exclusive", ""), "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var conflict *RelationConflictError
+			if !errors.As(exclusiveLinkConflict(tt.err, slugs), &conflict) {
+				t.Fatalf("got no conflict for %v", tt.err)
+			}
+			if conflict.Field != tt.wantField || conflict.Slug != tt.wantSlug {
+				t.Errorf("got conflict %+v, want field %q slug %q", conflict, tt.wantField, tt.wantSlug)
+			}
+		})
+	}
+
+	// Other errors are passed through
+	for _, err := range []error{
+		violation("idx_content_relation_link", ""),
+		&pgconn.PgError{Code: "23503", ConstraintName: "idx_content_relation_exclusive"},
+		errors.New("connection reset"),
+	} {
+		if got := exclusiveLinkConflict(err, slugs); got != err {
+			t.Errorf("got %v for %v, want the error unchanged", got, err)
+		}
+	}
+}
@@ -104,6 +104,21 @@ func (s *Schema) ValidateFields() error {
 			return fmt.Errorf("invalid field type: %s for field %s", field.Type, field.Name)
 		}
 
+		// Validate the indexing directives used by the knowledge index.
+		if err := validateIndexOptions(field); err != nil {
+			return err
+		}
+
+		// Validate the sortable option, which adds a sort index.
+		if err := validateSortOptions(field); err != nil {
+			return err
+		}
+
+		// Validate what deleting the referenced content or media does.
+		if err := validateOnDeleteOptions(field); err != nil {
+			return err
+		}
+
 		// Type-specific validations.
 		switch field.Type {
 		// Validate text-based fields.
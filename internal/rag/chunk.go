@@ -0,0 +1,73 @@
+package rag
+
+import (
+	"contentive/internal/models"
+	"strings"
+	"unicode"
+)
+
+const (
+	DefaultChunkSize    = models.DefaultIndexChunkSize
+	DefaultChunkOverlap = models.DefaultIndexChunkOverlap
+)
+
+// ChunkText splits text into chunks of at most size characters, where each
+// chunk repeats the last overlap characters of the previous one. Chunks are
+// cut at whitespace when possible so words are not split.
+func ChunkText(text string, size, overlap int) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	runes := []rune(text)
+	if len(runes) <= size {
+		return []string{text}
+	}
+
+	var chunks []string
+	start := 0
+	for start < len(runes) {
+		end := start + size
+		if end >= len(runes) {
+			end = len(runes)
+		} else {
+			// Walk back to the last whitespace, but never below half a chunk
+			for i := end; i > start+size/2; i-- {
+				if unicode.IsSpace(runes[i]) {
+					end = i
+					break
+				}
+			}
+		}
+
+		chunk := strings.TrimSpace(string(runes[start:end]))
+		if chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end == len(runes) {
+			break
+		}
+
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+// hasWords reports whether the text contains a letter or a number. A text
+// without any has no meaning to embed.
+func hasWords(text string) bool {
+	return strings.IndexFunc(text, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsNumber(r)
+	}) >= 0
+}
@@ -0,0 +1,86 @@
+package rag
+
+import (
+	"contentive/internal/models"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	htmlTagRegex    = regexp.MustCompile(`<[^>]*>`)
+	whitespaceRegex = regexp.MustCompile(`\s+`)
+)
+
+// Section is the text of one indexed field together with its index options
+type Section struct {
+	Field   string
+	Text    string
+	Options models.FieldIndexOptions
+}
+
+// IndexedChunk is a piece of a section, ready to be embedded
+type IndexedChunk struct {
+	Field   string
+	Content string
+	Weight  float64
+}
+
+// BuildSections turns the data of a content entry into plain text, one section
+// per indexed field, in schema order
+func BuildSections(fields []models.FieldDefinition, data map[string]interface{}) []Section {
+	var sections []Section
+	for _, field := range fields {
+		opts := field.IndexOptions()
+		if !opts.Include {
+			continue
+		}
+		text := fieldText(field, data[field.Name])
+		if text == "" {
+			continue
+		}
+		sections = append(sections, Section{Field: field.Name, Text: text, Options: opts})
+	}
+	return sections
+}
+
+// ChunkSections splits every section with its own chunk size and overlap and
+// prefixes the resulting chunks. Chunks without words are left out, they have
+// nothing to embed.
+func ChunkSections(sections []Section) []IndexedChunk {
+	var chunks []IndexedChunk
+	for _, section := range sections {
+		for _, text := range ChunkText(section.Text, section.Options.ChunkSize, section.Options.ChunkOverlap) {
+			if !hasWords(text) {
+				continue
+			}
+			chunks = append(chunks, IndexedChunk{
+				Field:   section.Field,
+				Content: section.Options.Prefix + text,
+				Weight:  section.Options.Weight,
+			})
+		}
+	}
+	return chunks
+}
+
+// fieldText converts a field value to plain text, or "" if there is nothing to index
+func fieldText(field models.FieldDefinition, value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return cleanText(v, field.Type)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// cleanText strips markup from rich text and collapses whitespace
+func cleanText(value string, fieldType models.FieldType) string {
+	if fieldType == models.FieldTypeRichText {
+		value = htmlTagRegex.ReplaceAllString(value, " ")
+	}
+	return strings.TrimSpace(whitespaceRegex.ReplaceAllString(value, " "))
+}
@@ -0,0 +1,185 @@
+package rag
+
+import (
+	"contentive/internal/database"
+	"contentive/internal/llm"
+	"contentive/internal/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// embedBatchSize is the number of chunks sent to the embedding provider at once
+const embedBatchSize = 64
+
+var ErrNoEmbeddingProvider = errors.New("embedding provider not initialized")
+
+// indexEntry brings the stored chunks of a content entry up to date. Entries
+// that are unpublished or deleted are removed from the index. Unless force is
+// set, entries whose indexed text has not changed are not embedded again.
+func indexEntry(ctx context.Context, entryID uuid.UUID, force bool) error {
+	embedder := llm.GetEmbeddingProvider()
+	if embedder == nil {
+		return ErrNoEmbeddingProvider
+	}
+
+	var entry models.ContentEntry
+	if err := database.DB.Where("id = ?", entryID).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return removeEntry(entryID)
+		}
+		return fmt.Errorf("failed to fetch content: %v", err)
+	}
+
+	if !entry.IsPublished {
+		return removeEntry(entryID)
+	}
+
+	var schema models.Schema
+	if err := database.DB.Where("id = ?", entry.ContentTypeID).First(&schema).Error; err != nil {
+		return fmt.Errorf("failed to fetch schema: %v", err)
+	}
+
+	var fields []models.FieldDefinition
+	if err := json.Unmarshal(schema.Fields, &fields); err != nil {
+		return fmt.Errorf("failed to unmarshal schema fields: %v", err)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(entry.Data, &data); err != nil {
+		return fmt.Errorf("failed to unmarshal content data: %v", err)
+	}
+
+	chunks := ChunkSections(BuildSections(fields, data))
+	hash := contentHash(embedder.Model(), chunks)
+	now := time.Now()
+
+	var state models.ContentIndexState
+	hasState := database.DB.Where("content_entry_id = ?", entry.ID).First(&state).Error == nil
+	if !force && hasState && state.Error == "" && state.ContentHash == hash {
+		// Nothing that is indexed has changed, only record that it was checked
+		return database.DB.Model(&state).Update("synced_at", now).Error
+	}
+
+	contentVersion := findPublishedVersion(entry)
+
+	rows := make([]models.ContentEmbedding, 0, len(chunks))
+	for start := 0; start < len(chunks); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+
+		input := make([]string, 0, end-start)
+		for _, chunk := range chunks[start:end] {
+			input = append(input, chunk.Content)
+		}
+
+		resp, err := embedder.Embed(ctx, llm.EmbeddingRequest{Input: input})
+		if err != nil {
+			recordIndexError(entry, err)
+			return fmt.Errorf("failed to embed content: %v", err)
+		}
+
+		for i, vector := range resp.Embeddings {
+			rows = append(rows, models.ContentEmbedding{
+				ContentEntryID:   entry.ID,
+				SchemaID:         schema.ID,
+				ContentVersionID: contentVersion.ID,
+				Version:          contentVersion.Version,
+				ChunkIndex:       start + i,
+				Field:            chunks[start+i].Field,
+				Content:          chunks[start+i].Content,
+				Weight:           chunks[start+i].Weight,
+				Model:            resp.Model,
+				Embedding:        models.Vector(vector),
+			})
+		}
+	}
+
+	state = models.ContentIndexState{
+		ContentEntryID:   entry.ID,
+		SchemaID:         schema.ID,
+		ContentVersionID: contentVersion.ID,
+		Version:          contentVersion.Version,
+		ContentHash:      hash,
+		Model:            embedder.Model(),
+		ChunkCount:       len(rows),
+		IndexedAt:        &now,
+		SyncedAt:         now,
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("content_entry_id = ?", entry.ID).Delete(&models.ContentEmbedding{}).Error; err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if err := tx.Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&state).Error
+	})
+}
+
+// removeEntry removes all stored chunks and the index state of a content entry
+func removeEntry(entryID uuid.UUID) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("content_entry_id = ?", entryID).Delete(&models.ContentEmbedding{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("content_entry_id = ?", entryID).Delete(&models.ContentIndexState{}).Error
+	})
+}
+
+// publishedVersion identifies the content version an entry's live data came from
+type publishedVersion struct {
+	ID      *uuid.UUID
+	Version int
+}
+
+// findPublishedVersion looks up the newest version whose data matches the entry.
+// Publishing an older version copies its data without changing current_version,
+// so the data is compared rather than trusting the version number.
+func findPublishedVersion(entry models.ContentEntry) publishedVersion {
+	var version models.ContentVersion
+	if err := database.DB.Where("content_entry_id = ? AND data = CAST(? AS jsonb)", entry.ID, string(entry.Data)).
+		Order("version DESC").
+		First(&version).Error; err == nil {
+		return publishedVersion{ID: &version.ID, Version: version.Version}
+	}
+	return publishedVersion{Version: entry.CurrentVersion}
+}
+
+// recordIndexError keeps the failure on the index state so it shows up in the status
+func recordIndexError(entry models.ContentEntry, indexErr error) {
+	state := models.ContentIndexState{
+		ContentEntryID: entry.ID,
+		SchemaID:       entry.ContentTypeID,
+		SyncedAt:       time.Now(),
+		Error:          indexErr.Error(),
+	}
+	database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "content_entry_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"error", "synced_at"}),
+	}).Create(&state)
+}
+
+// contentHash fingerprints the indexed chunks together with the embedding model,
+// so changing a field's index options also leads to re-embedding
+func contentHash(model string, chunks []IndexedChunk) string {
+	h := sha256.New()
+	h.Write([]byte(model))
+	for _, chunk := range chunks {
+		fmt.Fprintf(h, "\x00%s\x00%g\x00%s", chunk.Field, chunk.Weight, chunk.Content)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
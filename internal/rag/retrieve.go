@@ -0,0 +1,67 @@
+package rag
+
+import (
+	"contentive/internal/database"
+	"contentive/internal/llm"
+	"contentive/internal/models"
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Chunk is a piece of indexed content returned by a similarity search
+type Chunk struct {
+	ContentEntryID uuid.UUID `json:"content_entry_id"`
+	SchemaSlug     string    `json:"schema_slug"`
+	ContentSlug    string    `json:"content_slug"`
+	Version        int       `json:"version"`
+	ChunkIndex     int       `json:"chunk_index"`
+	Field          string    `json:"field"`
+	Content        string    `json:"content"`
+	Score          float64   `json:"score"` // cosine similarity times the field weight, higher is closer
+}
+
+// Search embeds the query and returns the topK most similar published chunks
+// belonging to the given schemas. Similarities are weighted per field. A query
+// without words matches nothing.
+func Search(ctx context.Context, query string, schemaIDs []uuid.UUID, topK int) ([]Chunk, error) {
+	if len(schemaIDs) == 0 || !hasWords(query) {
+		return []Chunk{}, nil
+	}
+
+	embedder := llm.GetEmbeddingProvider()
+	if embedder == nil {
+		return nil, ErrNoEmbeddingProvider
+	}
+
+	resp, err := embedder.Embed(ctx, llm.EmbeddingRequest{Input: []string{query}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %v", err)
+	}
+	if len(resp.Embeddings) != 1 {
+		return nil, fmt.Errorf("expected 1 query embedding, got %d", len(resp.Embeddings))
+	}
+	queryVector := models.Vector(resp.Embeddings[0]).String()
+
+	var chunks []Chunk
+	if err := database.DB.WithContext(ctx).Raw(`
+		SELECT e.content_entry_id, s.slug AS schema_slug, ce.slug AS content_slug,
+			e.version, e.chunk_index, e.field, e.content,
+			(1 - (e.embedding <=> ?::vector)) * e.weight AS score
+		FROM content_embeddings e
+		JOIN content_entries ce ON ce.id = e.content_entry_id
+		JOIN schemas s ON s.id = ce.content_type_id
+		WHERE ce.is_published = ?
+			AND e.schema_id IN ?
+			AND e.model = ?
+			AND vector_dims(e.embedding) = ?
+		ORDER BY score DESC
+		LIMIT ?`,
+		queryVector, true, schemaIDs, resp.Model, len(resp.Embeddings[0]), topK,
+	).Scan(&chunks).Error; err != nil {
+		return nil, fmt.Errorf("failed to search embeddings: %v", err)
+	}
+
+	return chunks, nil
+}
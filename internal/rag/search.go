@@ -0,0 +1,351 @@
+package rag
+
+import (
+	"contentive/internal/database"
+	"contentive/internal/llm"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// semanticCandidates bounds the number of entries taken from the vector index
+	semanticCandidates = 200
+	// snippetRadius is the number of characters shown around a match
+	snippetRadius = 80
+	// maxSnippets is the number of snippets returned per entry
+	maxSnippets = 3
+)
+
+// SearchQuery describes a hybrid search over the entries of one schema
+type SearchQuery struct {
+	Schema        models.Schema
+	Query         string
+	Alpha         float64 // weight of semantic similarity, 1 - Alpha is the weight of text ranking
+	PublishedOnly bool
+	Status        string // "published", "draft" or "" for both, ignored when PublishedOnly is set
+	Limit         int
+	Offset        int
+}
+
+// Snippet is a highlighted excerpt of a field, matches are wrapped in <mark>
+type Snippet struct {
+	Field string `json:"field"`
+	Text  string `json:"text"`
+}
+
+// SearchResult is a content entry with its blended score
+type SearchResult struct {
+	Entry         models.ContentEntry `json:"entry"`
+	Score         float64             `json:"score"`
+	TextScore     float64             `json:"text_score"`
+	SemanticScore float64             `json:"semantic_score"`
+	Snippets      []Snippet           `json:"snippets"`
+}
+
+// SearchResponse is a page of search results
+type SearchResponse struct {
+	Results  []SearchResult `json:"results"`
+	Total    int64          `json:"total"`
+	Alpha    float64        `json:"alpha"`
+	Semantic bool           `json:"semantic"` // false when results are ranked by text only
+}
+
+type scoredEntry struct {
+	ID            uuid.UUID
+	TextScore     float64
+	SemanticScore float64
+	Score         float64
+	Total         int64
+}
+
+// HybridSearch ranks entries by blending Postgres full-text ranking with the
+// similarity of their indexed chunks. Only fields included in the knowledge
+// index are searched, so password fields are never matched or shown. Entries
+// that are not indexed, such as drafts, are ranked by text alone. If no
+// embedding provider is available the search falls back to text only.
+//
+// The searched document depends on the schema's searchable fields, so no
+// expression index matches it and the full-text part scans the entries of the
+// schema. An index over all the data cannot narrow the entries first, as
+// excluded words would then also be looked up in the fields not searched.
+func HybridSearch(ctx context.Context, q SearchQuery) (*SearchResponse, error) {
+	var fields []models.FieldDefinition
+	if err := json.Unmarshal(q.Schema.Fields, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schema fields: %v", err)
+	}
+
+	var searchable []models.FieldDefinition
+	for _, field := range fields {
+		if field.IndexOptions().Include {
+			searchable = append(searchable, field)
+		}
+	}
+
+	params := map[string]interface{}{
+		"schema": q.Schema.ID,
+		"query":  q.Query,
+		"alpha":  q.Alpha,
+		"limit":  q.Limit,
+		"offset": q.Offset,
+	}
+
+	visibility := "TRUE"
+	if q.PublishedOnly || q.Status == "published" {
+		visibility = "ce.is_published"
+	} else if q.Status == "draft" {
+		visibility = "NOT ce.is_published"
+	}
+
+	// Build the searched document from the searchable fields only
+	document := "'{}'::jsonb"
+	if len(searchable) > 0 {
+		pairs := make([]string, 0, len(searchable))
+		for i, field := range searchable {
+			key := fmt.Sprintf("field%d", i)
+			params[key] = field.Name
+			pairs = append(pairs, fmt.Sprintf("CAST(@%s AS text), ce.data->CAST(@%s AS text)", key, key))
+		}
+		document = "jsonb_build_object(" + strings.Join(pairs, ", ") + ")"
+	}
+
+	semantic := "SELECT NULL::uuid AS id, 0::float8 AS semantic_score WHERE FALSE"
+	useSemantic := false
+	if q.Alpha > 0 && hasWords(q.Query) {
+		if embedder := llm.GetEmbeddingProvider(); embedder != nil {
+			resp, err := embedder.Embed(ctx, llm.EmbeddingRequest{Input: []string{q.Query}})
+			if err != nil || len(resp.Embeddings) != 1 {
+				logger.Error("Failed to embed search query, falling back to text search: %v", err)
+			} else {
+				useSemantic = true
+				params["vector"] = models.Vector(resp.Embeddings[0]).String()
+				params["model"] = resp.Model
+				params["dims"] = len(resp.Embeddings[0])
+				params["candidates"] = semanticCandidates
+				semantic = `
+					SELECT e.content_entry_id AS id,
+						MAX((1 - (e.embedding <=> CAST(@vector AS vector))) * e.weight) AS semantic_score
+					FROM content_embeddings e
+					JOIN content_entries ce ON ce.id = e.content_entry_id
+					WHERE e.schema_id = @schema AND e.model = @model AND vector_dims(e.embedding) = @dims
+						AND ` + visibility + `
+					GROUP BY e.content_entry_id
+					ORDER BY semantic_score DESC
+					LIMIT @candidates`
+			}
+		}
+	}
+	if !useSemantic {
+		params["alpha"] = 0.0
+	}
+
+	var scored []scoredEntry
+	if err := database.DB.WithContext(ctx).Raw(`
+		WITH lexical AS (
+			SELECT ce.id, ts_rank_cd(doc, query, 32) AS text_score
+			FROM content_entries ce,
+				websearch_to_tsquery('simple', @query) query,
+				jsonb_to_tsvector('simple', `+document+`, '["string", "numeric", "boolean"]') doc
+			WHERE ce.content_type_id = @schema AND `+visibility+` AND doc @@ query
+		),
+		semantic AS (`+semantic+`)
+		SELECT COALESCE(l.id, s.id) AS id,
+			COALESCE(l.text_score, 0) AS text_score,
+			COALESCE(s.semantic_score, 0) AS semantic_score,
+			CAST(@alpha AS float8) * COALESCE(s.semantic_score, 0)
+				+ (1 - CAST(@alpha AS float8)) * COALESCE(l.text_score, 0) AS score,
+			COUNT(*) OVER () AS total
+		FROM lexical l
+		FULL OUTER JOIN semantic s ON s.id = l.id
+		ORDER BY score DESC, id
+		LIMIT @limit OFFSET @offset`,
+		params,
+	).Scan(&scored).Error; err != nil {
+		return nil, fmt.Errorf("failed to search content: %v", err)
+	}
+
+	response := &SearchResponse{
+		Results:  []SearchResult{},
+		Alpha:    params["alpha"].(float64),
+		Semantic: useSemantic,
+	}
+	if len(scored) == 0 {
+		return response, nil
+	}
+	response.Total = scored[0].Total
+
+	ids := make([]uuid.UUID, len(scored))
+	for i, s := range scored {
+		ids[i] = s.ID
+	}
+	var entries []models.ContentEntry
+	if err := database.DB.WithContext(ctx).Where("id IN ?", ids).Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch content: %v", err)
+	}
+	entryByID := make(map[uuid.UUID]models.ContentEntry, len(entries))
+	for _, entry := range entries {
+		entryByID[entry.ID] = entry
+	}
+
+	terms := queryTerms(q.Query)
+	for _, s := range scored {
+		entry, ok := entryByID[s.ID]
+		if !ok {
+			continue
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(entry.Data, &data); err != nil {
+			logger.Error("Failed to unmarshal content data: %v", err)
+		}
+		response.Results = append(response.Results, SearchResult{
+			Entry:         entry,
+			Score:         s.Score,
+			TextScore:     s.TextScore,
+			SemanticScore: s.SemanticScore,
+			Snippets:      buildSnippets(searchable, data, terms),
+		})
+	}
+
+	return response, nil
+}
+
+// queryTerms extracts the lowercased words of a web search style query,
+// ignoring operators and excluded words
+func queryTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		if strings.HasPrefix(word, "-") || strings.EqualFold(word, "or") {
+			continue
+		}
+		word = strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		}))
+		if word != "" && !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// buildSnippets returns an excerpt around the first match in each searchable
+// field. If nothing matches, as for purely semantic hits, the start of the
+// first non-empty field is returned instead.
+func buildSnippets(fields []models.FieldDefinition, data map[string]interface{}, terms []string) []Snippet {
+	snippets := []Snippet{}
+	var fallback *Snippet
+	for _, field := range fields {
+		text := fieldText(field, data[field.Name])
+		if text == "" {
+			continue
+		}
+		runes := []rune(text)
+		lower := []rune(strings.ToLower(text))
+		if len(lower) != len(runes) {
+			// Lowercasing changed the length, so match on the original text
+			lower = runes
+		}
+
+		start := firstMatch(lower, terms)
+		if start < 0 {
+			if fallback == nil {
+				fallback = &Snippet{Field: field.Name, Text: excerpt(runes, lower, 0, terms)}
+			}
+			continue
+		}
+
+		snippets = append(snippets, Snippet{Field: field.Name, Text: excerpt(runes, lower, start, terms)})
+		if len(snippets) == maxSnippets {
+			break
+		}
+	}
+	if len(snippets) == 0 && fallback != nil {
+		snippets = append(snippets, *fallback)
+	}
+	return snippets
+}
+
+// firstMatch returns the rune offset of the earliest term in text, or -1
+func firstMatch(text []rune, terms []string) int {
+	first := -1
+	for _, term := range terms {
+		if i := runeIndex(text, []rune(term), 0); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	return first
+}
+
+// excerpt cuts a window around position and highlights every term inside it.
+// The text is HTML escaped so only the <mark> tags are markup.
+func excerpt(runes, lower []rune, position int, terms []string) string {
+	from := position - snippetRadius
+	if from < 0 {
+		from = 0
+	}
+	to := position + snippetRadius
+	if to > len(runes) {
+		to = len(runes)
+	}
+
+	// Collect the matched ranges inside the window
+	type span struct{ start, end int }
+	var spans []span
+	for _, term := range terms {
+		t := []rune(term)
+		for i := runeIndex(lower[:to], t, from); i >= 0; i = runeIndex(lower[:to], t, i+len(t)) {
+			spans = append(spans, span{i, i + len(t)})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	cursor := from
+	for _, s := range spans {
+		if s.start < cursor {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[cursor:s.start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[s.start:s.end])))
+		b.WriteString("</mark>")
+		cursor = s.end
+	}
+	b.WriteString(html.EscapeString(string(runes[cursor:to])))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// runeIndex returns the index of sub in text at or after from, or -1
+func runeIndex(text, sub []rune, from int) int {
+	if len(sub) == 0 {
+		return -1
+	}
+	for i := from; i+len(sub) <= len(text); i++ {
+		match := true
+		for j := range sub {
+			if text[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
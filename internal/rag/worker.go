@@ -0,0 +1,228 @@
+package rag
+
+import (
+	"contentive/internal/database"
+	"contentive/internal/llm"
+	"contentive/internal/logger"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// indexTimeout bounds the time spent indexing a single entry
+const indexTimeout = 2 * time.Minute
+
+type indexJob struct {
+	entryID  uuid.UUID
+	force    bool
+	queuedAt time.Time
+}
+
+// indexQueue is a FIFO of entries waiting to be indexed. An entry is queued at
+// most once; queueing it again only upgrades the job to a forced one.
+type indexQueue struct {
+	mu         sync.Mutex
+	jobs       []*indexJob
+	pending    map[uuid.UUID]*indexJob
+	processing *indexJob
+	notify     chan struct{}
+}
+
+var queue = &indexQueue{
+	pending: make(map[uuid.UUID]*indexJob),
+	notify:  make(chan struct{}, 1),
+}
+
+func (q *indexQueue) push(entryID uuid.UUID, force bool) {
+	q.mu.Lock()
+	if job, exists := q.pending[entryID]; exists {
+		job.force = job.force || force
+	} else {
+		job := &indexJob{entryID: entryID, force: force, queuedAt: time.Now()}
+		q.pending[entryID] = job
+		q.jobs = append(q.jobs, job)
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *indexQueue) pop() *indexJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.jobs) == 0 {
+		return nil
+	}
+	job := q.jobs[0]
+	q.jobs = q.jobs[1:]
+	delete(q.pending, job.entryID)
+	q.processing = job
+	return job
+}
+
+func (q *indexQueue) done() {
+	q.mu.Lock()
+	q.processing = nil
+	q.mu.Unlock()
+}
+
+// Enqueue schedules content entries to be re-indexed in the background. It is
+// called after content is published, updated, restored or deleted.
+func Enqueue(entryIDs ...uuid.UUID) {
+	for _, id := range entryIDs {
+		queue.push(id, false)
+	}
+}
+
+// EnqueueSchema queues every entry of a schema, including entries that only
+// remain in the index. With force set, unchanged entries are embedded again,
+// which rebuilds the schema's index. It returns the number of queued entries.
+func EnqueueSchema(schemaID uuid.UUID, force bool) (int, error) {
+	var entryIDs []uuid.UUID
+	if err := database.DB.Raw(`
+		SELECT id FROM content_entries WHERE content_type_id = ?
+		UNION
+		SELECT content_entry_id FROM content_index_states WHERE schema_id = ?`,
+		schemaID, schemaID,
+	).Scan(&entryIDs).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch schema content: %v", err)
+	}
+
+	for _, id := range entryIDs {
+		queue.push(id, force)
+	}
+	return len(entryIDs), nil
+}
+
+// EnqueueStale queues entries whose index state is missing, outdated, failed or
+// made with another embedding model, as well as entries that should no longer
+// be indexed. It catches up on changes made while the worker was not running.
+func EnqueueStale() error {
+	embedder := llm.GetEmbeddingProvider()
+	if embedder == nil {
+		return ErrNoEmbeddingProvider
+	}
+
+	var entryIDs []uuid.UUID
+	if err := database.DB.Raw(`
+		SELECT ce.id FROM content_entries ce
+		LEFT JOIN content_index_states st ON st.content_entry_id = ce.id
+		WHERE ce.is_published = ?
+			AND (st.content_entry_id IS NULL OR st.synced_at < ce.updated_at OR st.model <> ? OR st.error <> '')
+		UNION
+		SELECT st.content_entry_id FROM content_index_states st
+		LEFT JOIN content_entries ce ON ce.id = st.content_entry_id
+		WHERE ce.id IS NULL OR ce.is_published = ?`,
+		true, embedder.Model(), false,
+	).Scan(&entryIDs).Error; err != nil {
+		return fmt.Errorf("failed to fetch stale content: %v", err)
+	}
+
+	Enqueue(entryIDs...)
+	logger.GeneralAction(fmt.Sprintf("Queued %d stale entries for knowledge indexing", len(entryIDs)))
+	return nil
+}
+
+// StartWorker processes the index queue until ctx is cancelled
+func StartWorker(ctx context.Context) {
+	go func() {
+		for {
+			job := queue.pop()
+			if job == nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-queue.notify:
+					continue
+				}
+			}
+
+			jobCtx, cancel := context.WithTimeout(ctx, indexTimeout)
+			if err := indexEntry(jobCtx, job.entryID, job.force); err != nil {
+				logger.Error("Failed to index content %s: %v", job.entryID, err)
+			}
+			cancel()
+			queue.done()
+		}
+	}()
+	logger.GeneralAction("Knowledge index worker started")
+}
+
+// SchemaIndexStatus summarizes the knowledge index of one schema
+type SchemaIndexStatus struct {
+	SchemaID      uuid.UUID  `json:"schema_id"`
+	SchemaSlug    string     `json:"schema_slug"`
+	Published     int64      `json:"published"` // published entries
+	Indexed       int64      `json:"indexed"`   // published entries whose index is up to date
+	Stale         int64      `json:"stale"`     // published entries waiting to be indexed
+	Failed        int64      `json:"failed"`    // entries whose last indexing failed
+	Chunks        int64      `json:"chunks"`
+	LastIndexedAt *time.Time `json:"last_indexed_at"`
+	OldestStaleAt *time.Time `json:"oldest_stale_at"` // update time of the longest waiting entry
+	LagSeconds    float64    `json:"lag_seconds"`
+}
+
+// IndexStatus reports the state of the index queue and how far behind each schema is
+type IndexStatus struct {
+	Model          string              `json:"model"`
+	QueueLength    int                 `json:"queue_length"`
+	OldestQueuedAt *time.Time          `json:"oldest_queued_at"`
+	Processing     *uuid.UUID          `json:"processing"`
+	Schemas        []SchemaIndexStatus `json:"schemas"`
+}
+
+// Status returns the current IndexStatus
+func Status() (*IndexStatus, error) {
+	embedder := llm.GetEmbeddingProvider()
+	if embedder == nil {
+		return nil, ErrNoEmbeddingProvider
+	}
+
+	status := &IndexStatus{Model: embedder.Model()}
+
+	queue.mu.Lock()
+	status.QueueLength = len(queue.jobs)
+	if len(queue.jobs) > 0 {
+		oldest := queue.jobs[0].queuedAt
+		status.OldestQueuedAt = &oldest
+	}
+	if queue.processing != nil {
+		id := queue.processing.entryID
+		status.Processing = &id
+	}
+	queue.mu.Unlock()
+
+	staleCondition := "ce.is_published AND (st.content_entry_id IS NULL OR st.synced_at < ce.updated_at OR st.model <> @model)"
+	if err := database.DB.Raw(`
+		SELECT s.id AS schema_id, s.slug AS schema_slug,
+			COUNT(ce.id) FILTER (WHERE ce.is_published) AS published,
+			COUNT(ce.id) FILTER (WHERE ce.is_published AND NOT (`+staleCondition+`) AND st.error = '') AS indexed,
+			COUNT(ce.id) FILTER (WHERE `+staleCondition+`) AS stale,
+			COUNT(st.content_entry_id) FILTER (WHERE st.error <> '') AS failed,
+			COALESCE(SUM(st.chunk_count), 0) AS chunks,
+			MAX(st.indexed_at) AS last_indexed_at,
+			MIN(ce.updated_at) FILTER (WHERE `+staleCondition+`) AS oldest_stale_at
+		FROM schemas s
+		LEFT JOIN content_entries ce ON ce.content_type_id = s.id
+		LEFT JOIN content_index_states st ON st.content_entry_id = ce.id
+		GROUP BY s.id, s.slug
+		ORDER BY s.slug`,
+		map[string]interface{}{"model": embedder.Model()},
+	).Scan(&status.Schemas).Error; err != nil {
+		return nil, fmt.Errorf("failed to compute index status: %v", err)
+	}
+
+	for i := range status.Schemas {
+		if oldest := status.Schemas[i].OldestStaleAt; oldest != nil {
+			status.Schemas[i].LagSeconds = time.Since(*oldest).Seconds()
+		}
+	}
+
+	return status, nil
+}
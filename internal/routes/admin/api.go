@@ -28,6 +28,9 @@ func RegisterAPIUserRoutes(app *fiber.App) {
 	// Update an API user
 	api.Put("/:id", handler.UpdateAPIUser)
 
+	// Get the LLM token usage of an API user
+	api.Get("/:id/usage", handler.GetAPIUserUsage)
+
 	// Delete an API user
 	api.Delete("/:id", handler.DeleteAPIUser)
 
@@ -19,6 +19,12 @@ func RegisterAdminContentRoutes(app *fiber.App) {
 	// Get content
 	content.Get("/schema/:schema_id", handler.GetContent)
 
+	// Search content, registered before the content id route so "search" is not taken as an id
+	content.Get("/schema/:schema_id/search", handler.SearchContent)
+
+	// Generate a field value with the LLM
+	content.Post("/schema/:schema_id/generate", handler.GenerateField)
+
 	// Get content by id
 	content.Get("/schema/:schema_id/:content_id", handler.GetContentById)
 
@@ -34,6 +40,17 @@ func RegisterAdminContentRoutes(app *fiber.App) {
 	// Unpublish content
 	content.Post("/schema/:schema_id/:content_id/unpublish", handler.UnpublishContent)
 
+	// Schedule publishing and unpublishing
+	content.Get("/schedules", handler.ListSchedules)
+	content.Post("/schema/:schema_id/:content_id/schedule", handler.ScheduleContent)
+	content.Delete("/schema/:schema_id/:content_id/schedule", handler.CancelContentSchedule)
+
+	// List the entries that refer to the content
+	content.Get("/schema/:schema_id/:content_id/references", handler.GetContentReferences)
+
+	// Translate content into a new draft version with the LLM
+	content.Post("/schema/:schema_id/:content_id/translate", handler.TranslateContent)
+
 	// Get content versions
 	content.Get("/schema/:schema_id/:content_id/versions", handler.ListContentVersions)
 	content.Get("/schema/:schema_id/:content_id/versions/:version", handler.GetContentVersion)
@@ -0,0 +1,31 @@
+package adminroutes
+
+import (
+	"contentive/internal/handler"
+	"contentive/internal/middleware"
+	"contentive/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func RegisterAdminLLMRoutes(app *fiber.App) {
+	llmRoutes := app.Group("/admin/llm")
+	llmRoutes.Use(middleware.AuthenticateAdminUserJWT())
+	llmRoutes.Use(middleware.RequireRole(models.AdminUserRoleAdmin))
+
+	// Knowledge index status and lag
+	llmRoutes.Get("/index", handler.GetKnowledgeIndexStatus)
+
+	// Rebuild the knowledge index of one schema
+	llmRoutes.Post("/index/schema/:schema_id/rebuild", handler.RebuildKnowledgeIndex)
+
+	// Prompt templates, saving an existing template adds a version
+	templates := llmRoutes.Group("/templates")
+	templates.Post("/", handler.CreatePromptTemplate)
+	templates.Get("/", handler.GetPromptTemplates)
+	templates.Get("/:name", handler.GetPromptTemplate)
+	templates.Put("/:name", handler.UpdatePromptTemplate)
+	templates.Delete("/:name", handler.DeletePromptTemplate)
+	templates.Get("/:name/versions", handler.GetPromptTemplateVersions)
+	templates.Get("/:name/versions/:version", handler.GetPromptTemplateVersion)
+}
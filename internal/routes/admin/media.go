@@ -15,6 +15,7 @@ func RegisterAdminMediaRoutes(app *fiber.App) {
 
 	media.Post("/", handler.UploadMedia)
 	media.Get("/:id", handler.GetMedia)
+	media.Get("/:id/usages", handler.GetMediaUsages)
 	media.Delete("/:id", handler.DeleteMedia)
 	media.Get("/", handler.ListMedia)
 }
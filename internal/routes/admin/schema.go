@@ -18,6 +18,9 @@ func RegisterAdminSchemaRoutes(app *fiber.App) {
 
 	schema.Post("/", handler.CreateSchema)
 
+	// Draft a schema from a description with the LLM, nothing is saved
+	schema.Post("/generate", handler.GenerateSchema)
+
 	schema.Get("/:id", handler.GetSchema)
 
 	schema.Get("/", handler.ListSchemas)
@@ -29,6 +29,13 @@ func RegisterAPIContentRoutes(app *fiber.App) {
 		handler.GetContent,
 	)
 
+	// Search content - requires {schema}:read scope, only published content is returned
+	content.Get("/schema/:schema_slug/search",
+		middleware.GetSchemaFromSlug(),
+		middleware.RequireSchemaScope("read"),
+		handler.SearchContent,
+	)
+
 	content.Get("/schema/:schema_slug/:content_slug",
 		middleware.GetSchemaFromSlug(),
 		middleware.GetContentFromSlug(),
@@ -12,12 +12,26 @@ func RegisterAPILLMRoutes(app *fiber.App) {
 	llmRoutes := api.Group("/llm")
 	// All API routes require API token authentication
 	llmRoutes.Use(middleware.AuthenticateAPIUserToken())
+	// Token quotas of the API user
+	llmRoutes.Use(middleware.EnforceLLMQuota())
 	// Chat
 	llmRoutes.Post("/chat", middleware.RequireAPIScope("llm:chat"), handler.LLMChat)
 
 	// Stream Chat
 	llmRoutes.Post("/chat/stream", middleware.RequireAPIScope("llm:chat"), handler.LLMChatStream)
 
+	// Conversations, scoped to the calling API user
+	conversations := llmRoutes.Group("/conversations", middleware.RequireAPIScope("llm:chat"))
+	conversations.Post("/", handler.CreateConversation)
+	conversations.Get("/", handler.ListConversations)
+	conversations.Get("/:conversation_id", handler.GetConversation)
+	conversations.Delete("/:conversation_id", handler.DeleteConversation)
+	conversations.Post("/:conversation_id/messages", handler.AppendConversationMessage)
+	conversations.Post("/:conversation_id/messages/stream", handler.AppendConversationMessageStream)
+
+	// Prompt templates
+	llmRoutes.Post("/templates/:name/run", middleware.RequireAPIScope("llm:chat"), handler.RunPromptTemplate)
+
 	// RAG
 	llmRoutes.Post("/knowledge", middleware.RequireAPIScope("llm:rag"), handler.LLMKnowledgeQuery)
 
@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	"contentive/internal/database"
+	"contentive/internal/logger"
+	"contentive/internal/models"
+	"contentive/internal/rag"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// lockKey is the advisory lock that lets a single instance apply the due
+// schedules at a time
+const lockKey int64 = 0x636f6e74656e74 // "content"
+
+// batchSize bounds the entries handled per transaction
+const batchSize = 100
+
+// Start applies the due schedules every interval until ctx is cancelled
+func Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		logger.GeneralAction("Content scheduler disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := RunDue(time.Now()); err != nil {
+				logger.Error("Failed to apply content schedules: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	logger.GeneralAction("Content scheduler started")
+}
+
+// RunDue publishes and unpublishes the entries whose schedule is due at now.
+// It returns the number of entries changed. When another instance holds the
+// lock it does nothing, that instance applies the schedules.
+func RunDue(now time.Time) (int, error) {
+	total := 0
+	for {
+		var changed []uuid.UUID
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			// The lock is released with the transaction, and the schedules it
+			// applied are cleared in the same transaction
+			var locked bool
+			if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", lockKey).Scan(&locked).Error; err != nil {
+				return err
+			}
+			if !locked {
+				return nil
+			}
+
+			var entries []models.ContentEntry
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("publish_at <= ? OR unpublish_at <= ?", now, now).
+				Order("id").
+				Limit(batchSize).
+				Find(&entries).Error; err != nil {
+				return err
+			}
+
+			for i := range entries {
+				apply(&entries[i], now)
+				if err := tx.Save(&entries[i]).Error; err != nil {
+					return fmt.Errorf("failed to apply schedule of content %s: %v", entries[i].Slug, err)
+				}
+				changed = append(changed, entries[i].ID)
+			}
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+
+		total += len(changed)
+		rag.Enqueue(changed...)
+		if len(changed) > 0 {
+			logger.GeneralAction(fmt.Sprintf("Applied the schedules of %d content entries", len(changed)))
+		}
+		if len(changed) < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// apply brings an entry to the state of its due schedules. When both are due
+// the later one wins, as if they had run on time.
+func apply(entry *models.ContentEntry, now time.Time) {
+	publishAt, unpublishAt := entry.PublishAt, entry.UnpublishAt
+	publish := publishAt != nil && !publishAt.After(now)
+	unpublish := unpublishAt != nil && !unpublishAt.After(now)
+	if publish && unpublish {
+		if publishAt.After(*unpublishAt) {
+			unpublish = false
+			entry.UnpublishAt = nil
+		} else {
+			publish = false
+			entry.PublishAt = nil
+		}
+	}
+
+	if publish {
+		entry.IsPublished = true
+		entry.PublishedAt = publishAt
+		entry.PublishedBy = entry.ScheduledBy
+		entry.PublishAt = nil
+	}
+	if unpublish {
+		entry.IsPublished = false
+		entry.PublishedAt = nil
+		entry.PublishedBy = nil
+		entry.UnpublishAt = nil
+	}
+
+	if entry.PublishAt == nil && entry.UnpublishAt == nil {
+		entry.ScheduledBy = nil
+	}
+}